@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sky9464/ykt"
+	"strings"
+	"time"
+)
+
+// RunCommand 执行本地子命令，返回进程退出码
+func RunCommand(args []string) int {
+	switch args[0] {
+	case "-h", "-help", "--help", "help":
+		printUsage()
+		return 0
+	case "note":
+		return runNote(args[1:])
+	case "export":
+		return runExport(args[1:])
+	case "archive":
+		return runArchive(args[1:])
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: %s\n", args[0])
+		printUsage()
+		return 2
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "用法:")
+	fmt.Fprintln(os.Stderr, "  Fuck-YuKeTang                                   正常上课")
+	fmt.Fprintln(os.Stderr, "  Fuck-YuKeTang note -pres <PPT编号> [选项]       查看或添加幻灯片批注")
+	fmt.Fprintln(os.Stderr, "  Fuck-YuKeTang export -pres <PPT编号> [-o 文件]  导出PPT和批注为Markdown、HTML或PDF")
+	fmt.Fprintln(os.Stderr, "  Fuck-YuKeTang archive fsck [-fix]               检查本地存档是否完整")
+	fmt.Fprintln(os.Stderr, "  Fuck-YuKeTang archive gc [选项]                 清理过期快照和无用图片")
+}
+
+// runNote 查看、添加或删除幻灯片批注
+func runNote(args []string) int {
+	fs := flag.NewFlagSet("note", flag.ContinueOnError)
+	pres := fs.String("pres", "", "PPT编号（必填）")
+	sid := fs.String("sid", "", "幻灯片编号，不填时列出该PPT的全部批注")
+	text := fs.String("text", "", "笔记内容")
+	highlight := fs.String("highlight", "", "划线的原文片段，多个用|分隔")
+	tags := fs.String("tag", "", "标签，多个用逗号分隔")
+	remove := fs.Bool("rm", false, "删除该幻灯片上的全部批注")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *pres == "" {
+		fs.Usage()
+		return 2
+	}
+
+	if *sid == "" {
+		if *remove {
+			fmt.Fprintln(os.Stderr, "删除批注需要指定 -sid")
+			return 2
+		}
+		notes, err := ykt.LoadNotes(*pres)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "读取批注失败: %v\n", err)
+			return 1
+		}
+		if len(notes) == 0 {
+			fmt.Printf("编号为%s的PPT还没有批注\n", *pres)
+			return 0
+		}
+		for _, note := range ykt.SortNotes(notes) {
+			fmt.Printf("## 第%d页（%s）\n\n%s\n\n", note.SlideIndex, note.Sid, ykt.NoteMarkdown(note))
+		}
+		return 0
+	}
+
+	if *remove {
+		if err := ykt.DeleteNote(*pres, *sid); err != nil {
+			fmt.Fprintf(os.Stderr, "删除批注失败: %v\n", err)
+			return 1
+		}
+		fmt.Printf("已删除幻灯片%s上的批注\n", *sid)
+		return 0
+	}
+
+	if *text == "" && *highlight == "" && *tags == "" {
+		fmt.Fprintln(os.Stderr, "请至少指定 -text、-highlight 或 -tag 中的一项")
+		return 2
+	}
+	note, err := ykt.AddNote(*pres, *sid, *text, splitList(*highlight, "|"), splitList(*tags, ","))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "保存批注失败: %v\n", err)
+		return 1
+	}
+	fmt.Println(ykt.NoteMarkdown(note))
+	return 0
+}
+
+// runExport 导出 PPT 和批注
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	pres := fs.String("pres", "", "PPT编号（必填）")
+	output := fs.String("o", "", "输出文件，不填时输出到终端")
+	format := fs.String("format", "", "导出格式：md、html或pdf，不填时按输出文件的扩展名判断，默认md")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *pres == "" {
+		fs.Usage()
+		return 2
+	}
+	if *format == "" {
+		switch strings.ToLower(filepath.Ext(*output)) {
+		case ".html", ".htm":
+			*format = "html"
+		case ".pdf":
+			*format = "pdf"
+		default:
+			*format = "md"
+		}
+	}
+
+	var data []byte
+	var err error
+	switch *format {
+	case "md":
+		var markdown string
+		markdown, err = ykt.ExportMarkdown(*pres)
+		data = []byte(markdown)
+	case "html":
+		var page string
+		page, err = ykt.ExportHTML(*pres)
+		data = []byte(page)
+	case "pdf":
+		if *output == "" {
+			fmt.Fprintln(os.Stderr, "导出PDF需要用 -o 指定输出文件")
+			return 2
+		}
+		data, err = ykt.ExportPDF(*pres)
+	default:
+		fmt.Fprintf(os.Stderr, "不支持的导出格式: %s\n", *format)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "导出失败: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "导出失败: %v\n", err)
+		return 1
+	}
+	fmt.Printf("已导出到%s\n", *output)
+	return 0
+}
+
+// runArchive 检查或清理本地存档
+func runArchive(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return 2
+	}
+	switch args[0] {
+	case "fsck":
+		fs := flag.NewFlagSet("archive fsck", flag.ContinueOnError)
+		fix := fs.Bool("fix", false, "按PPT重建不一致的题库条目，并下载缺失的图片")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		report, err := ykt.ArchiveFsck(*fix)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "检查失败: %v\n", err)
+			return 1
+		}
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+		if report.AssetsSkipped {
+			fmt.Println("未启用图片缓存，跳过图片检查（可用 -fix 下载图片）")
+		}
+		if report.Fixed > 0 {
+			fmt.Printf("已修复%d个问题\n", report.Fixed)
+		}
+		fmt.Printf("共检查%d个PPT、%d张图片，发现%d个问题\n", report.Decks, report.Assets, len(report.Problems))
+		if len(report.Problems) > 0 {
+			return 1
+		}
+		return 0
+	case "gc":
+		fs := flag.NewFlagSet("archive gc", flag.ContinueOnError)
+		keep := fs.Int("keep", 5, "每个PPT最多保留的快照数量")
+		maxAge := fs.Int("max-age", 30, "快照最多保留的天数，0表示不按时间清理")
+		dryRun := fs.Bool("dry-run", false, "只列出要删除的文件，不实际删除")
+		if err := fs.Parse(args[1:]); err != nil {
+			return 2
+		}
+		report, err := ykt.ArchiveGC(ykt.GCPolicy{
+			KeepSnapshots: *keep,
+			MaxAge:        time.Duration(*maxAge) * 24 * time.Hour,
+			DryRun:        *dryRun,
+		})
+		if report != nil {
+			for _, name := range report.Removed {
+				fmt.Println(name)
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "清理失败: %v\n", err)
+			return 1
+		}
+		for _, problem := range report.Problems {
+			fmt.Println(problem)
+		}
+		if report.AssetsSkipped {
+			fmt.Println("有PPT或快照无法解析，没有清理图片（可用 archive fsck 检查）")
+		}
+		if *dryRun {
+			fmt.Printf("将删除%d个文件\n", len(report.Removed))
+		} else {
+			fmt.Printf("已删除%d个文件\n", len(report.Removed))
+		}
+		if len(report.Problems) > 0 {
+			return 1
+		}
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "未知命令: archive %s\n", args[0])
+		printUsage()
+		return 2
+	}
+}
+
+func splitList(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, sep)
+}
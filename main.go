@@ -288,6 +288,7 @@ type Config struct {
 	EndTime         string `yaml:"endtime"`
 	ProblemDelayMin int    `yaml:"ProblemDelayMin"`
 	ProblemDelayMax int    `yaml:"ProblemDelayMax"`
+	CacheAssets     bool   `yaml:"CacheAssets"`
 }
 
 func InitFiles() {
@@ -319,6 +320,7 @@ func InitFiles() {
 			EndTime:         "2024-11-02T00:00",
 			ProblemDelayMin: 10,
 			ProblemDelayMax: 15,
+			CacheAssets:     false,
 		})
 		// 在config.yml文件中写点儿注释
 		file.WriteString("# 参数详解\n")
@@ -328,6 +330,7 @@ func InitFiles() {
 		file.WriteString("# EndTime: 你的课程结束时间            格式为2004-12-26T05:13:14\n")
 		file.WriteString("# ProblemDelayMin: 你的题目提交延时最小时间    单位为秒\n")
 		file.WriteString("# ProblemDelayMax: 你的题目提交延时最大时间    单位为秒\n")
+		file.WriteString("# CacheAssets: 保存PPT时是否下载幻灯片图片到ppts/assets   默认为false\n")
 		if err != nil {
 			log.Fatalf("error: %v", err)
 		}
@@ -368,6 +371,10 @@ func CheckTime(StartTime, EndTime string) (*time.Location, time.Time, time.Time)
 	return loc, startTime, endTime
 }
 func main() {
+	// 带子命令时只执行对应的本地操作，不连接课堂
+	if len(os.Args) > 1 {
+		os.Exit(RunCommand(os.Args[1:]))
+	}
 	InitFiles()
 	// 创建多重输出
 	logFile, err := os.OpenFile("log.txt", os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
@@ -394,6 +401,7 @@ func main() {
 	log.Printf("EndTime: %s\n", config.EndTime)
 	log.Printf("ProblemDelayMin: %d\n", config.ProblemDelayMin)
 	log.Printf("ProblemDelayMax: %d\n", config.ProblemDelayMax)
+	log.Printf("CacheAssets: %t\n", config.CacheAssets)
 	log.Println("============================================================================================================")
 
 	// 检查当前sessionId是否过期
@@ -418,6 +426,7 @@ func main() {
 		log.Println("sessionId已更新，请重新运行程序。")
 		os.Exit(0)
 	}
+	ykt.AssetCaching = config.CacheAssets
 	loc, _, endTime := CheckTime(config.StartTime, config.EndTime)
 	log.Printf("根据配置信息，程序将在 %s 结束\n", endTime)
 	ykt.SaveCourseId(config.SessionId)
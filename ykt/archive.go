@@ -0,0 +1,715 @@
+package ykt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 本地存档：
+//
+//	ppts/<presentationID>.json          最新的 PPT
+//	ppts/<presentationID>.notes.json    个人批注
+//	ppts/snapshots/<presentationID>/    PPT 内容变化前的旧版本
+//	ppts/assets/<sha256><扩展名>         幻灯片图片，文件名即内容的哈希
+//	ppts/assets/index.json              图片地址到缓存文件的映射
+//	bank.json                           题库（由 PPT 生成的题目索引）
+
+const (
+	archiveDir   = "./ppts"
+	snapshotDir  = "./ppts/snapshots"
+	assetDir     = "./ppts/assets"
+	assetIndex   = "./ppts/assets/index.json"
+	bankFilePath = "./bank.json"
+	// 快照文件名中的时间格式，精确到纳秒，同一秒内的两次变化不会互相覆盖
+	snapshotTimeLayout = "20060102T150405.000000000"
+	// 按秒的格式解析时也能读出小数部分，同时兼容以前按秒命名的快照
+	snapshotParseLayout = "20060102T150405"
+)
+
+// 图片缓存的索引会被多个 StorePPT 同时更新
+var assetMu sync.Mutex
+
+// writeFileAtomic 先写临时文件再改名，避免写到一半时留下损坏的文件
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // 改名成功后这里什么也不做
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// deckPath 返回 PPT 文件路径
+func deckPath(presentationID string) string {
+	return fmt.Sprintf("%s/%s.json", archiveDir, presentationID)
+}
+
+// checkDeck 检查 PPT 内容能否解析
+func checkDeck(data []byte) error {
+	if !gjson.ValidBytes(data) {
+		return fmt.Errorf("不是合法的JSON")
+	}
+	if !gjson.GetBytes(data, "data.slides").IsArray() {
+		return fmt.Errorf("缺少data.slides")
+	}
+	return nil
+}
+
+// snapshotDeck 函数功能：PPT 内容变化时把旧版本移到快照目录，参数：presentationID（string）、newData，返回值：error
+func snapshotDeck(presentationID string, newData []byte) error {
+	oldData, err := os.ReadFile(deckPath(presentationID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	// 损坏的旧文件没有保留价值，幻灯片没变也不需要快照
+	if checkDeck(oldData) != nil || gjson.GetBytes(oldData, "data.slides").Raw == gjson.GetBytes(newData, "data.slides").Raw {
+		return nil
+	}
+	dir := filepath.Join(snapshotDir, presentationID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	taken := time.Now()
+	name := filepath.Join(dir, taken.Format(snapshotTimeLayout)+".json")
+	for {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			break
+		}
+		taken = taken.Add(time.Nanosecond)
+		name = filepath.Join(dir, taken.Format(snapshotTimeLayout)+".json")
+	}
+	return writeFileAtomic(name, oldData, 0644)
+}
+
+// deckAssets 返回 PPT 中引用的图片地址
+func deckAssets(data []byte) []string {
+	seen := map[string]bool{}
+	var urls []string
+	add := func(u string) {
+		if strings.HasPrefix(u, "http") && !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	gjson.GetBytes(data, "data.slides").ForEach(func(_, slide gjson.Result) bool {
+		add(slide.Get("cover").String())
+		slide.Get("shapes").ForEach(func(_, shape gjson.Result) bool {
+			add(shape.Get("url").String())
+			return true
+		})
+		return true
+	})
+	return urls
+}
+
+func loadAssetIndex() (map[string]string, error) {
+	index := map[string]string{}
+	data, err := os.ReadFile(assetIndex)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("解析%s失败: %v", assetIndex, err)
+	}
+	return index, nil
+}
+
+func saveAssetIndex(index map[string]string) error {
+	data, err := json.MarshalIndent(index, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(assetIndex, data, 0644)
+}
+
+// hashFile 计算文件的 sha256
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// assetHash 从缓存文件名中取出哈希
+func assetHash(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// AssetCaching 是否在保存 PPT 时缓存幻灯片图片，由 config.yml 中的 CacheAssets 控制
+var AssetCaching bool
+
+// CacheAssets 函数功能：把 PPT 引用的图片下载到本地缓存，参数：presentationID（string），返回值：无
+func CacheAssets(presentationID string) {
+	data, err := os.ReadFile(deckPath(presentationID))
+	if err != nil {
+		log.Println("Error reading file:", err)
+		return
+	}
+	if fetched := cacheURLs(deckAssets(data)); fetched > 0 {
+		log.Printf("-----------编号为%s的PPT缓存了%d张图片------------\n", presentationID, fetched)
+	}
+}
+
+// cacheURLs 下载缺失或损坏的图片并更新索引，返回下载的数量
+func cacheURLs(urls []string) int {
+	assetMu.Lock()
+	defer assetMu.Unlock()
+
+	index, err := loadAssetIndex()
+	if err != nil {
+		log.Println("Error reading asset index:", err)
+		return 0
+	}
+	if err := os.MkdirAll(assetDir, os.ModePerm); err != nil {
+		log.Println("Error creating asset dir:", err)
+		return 0
+	}
+
+	fetched := 0
+	for _, u := range urls {
+		if name, ok := index[u]; ok {
+			if sum, err := hashFile(filepath.Join(assetDir, name)); err == nil && sum == assetHash(name) {
+				continue
+			}
+		}
+		name, err := downloadAsset(u)
+		if err != nil {
+			log.Printf("图片下载失败: %s, %v\n", u, err)
+			continue
+		}
+		index[u] = name
+		fetched++
+	}
+	if fetched == 0 {
+		return 0
+	}
+	if err := saveAssetIndex(index); err != nil {
+		log.Println("Error writing asset index:", err)
+		return 0
+	}
+	return fetched
+}
+
+// downloadAsset 下载图片并以内容哈希命名保存，返回缓存文件名
+func downloadAsset(u string) (string, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(u)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("状态码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(body)
+	ext := path.Ext(strings.SplitN(u, "?", 2)[0])
+	if len(ext) > 6 {
+		ext = ""
+	}
+	name := hex.EncodeToString(sum[:]) + ext
+	if err := writeFileAtomic(filepath.Join(assetDir, name), body, 0644); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// listDecks 返回存档中所有 PPT 的编号
+func listDecks() ([]string, error) {
+	entries, err := os.ReadDir(archiveDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") || strings.HasSuffix(name, ".notes.json") {
+			continue
+		}
+		ids = append(ids, strings.TrimSuffix(name, ".json"))
+	}
+	return ids, nil
+}
+
+// listSnapshots 返回某个 PPT 的快照文件，按时间从新到旧排列
+func listSnapshots(presentationID string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(snapshotDir, presentationID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ti, erri := snapshotTime(names[i])
+		tj, errj := snapshotTime(names[j])
+		if erri != nil || errj != nil || ti.Equal(tj) {
+			return names[i] > names[j]
+		}
+		return ti.After(tj)
+	})
+	return names, nil
+}
+
+// snapshotTime 从快照文件名解析保存时间
+func snapshotTime(name string) (time.Time, error) {
+	return time.ParseInLocation(snapshotParseLayout, strings.TrimSuffix(name, ".json"), time.Local)
+}
+
+// FsckReport 存档检查的结果，每条问题一行
+type FsckReport struct {
+	Decks         int
+	Assets        int
+	AssetsSkipped bool // 没有启用图片缓存，跳过了图片检查
+	Fixed         int  // -fix 修复的问题数量
+	Problems      []string
+}
+
+func (r *FsckReport) add(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// fsckRepair 检查中发现的、可以自动修复的问题
+type fsckRepair struct {
+	staleDecks   []string // 题库条目和 PPT 不一致
+	missingDecks []string // 题库中有题目但 PPT 不存在
+	bankMissing  bool
+	assets       []string // 需要重新下载的图片
+}
+
+func (f *fsckRepair) empty() bool {
+	return len(f.staleDecks) == 0 && len(f.missingDecks) == 0 && !f.bankMissing && len(f.assets) == 0
+}
+
+// ArchiveFsck 函数功能：检查存档完整性（PPT 能否解析、图片缓存是否完整、题库是否和 PPT 一致），
+// 参数：fix（bool，为 true 时重建不一致的题库条目并补全图片缓存），返回值：检查结果和 error
+func ArchiveFsck(fix bool) (*FsckReport, error) {
+	report, repair, err := checkArchive(fix)
+	if err != nil || !fix || repair.empty() {
+		return report, err
+	}
+
+	// 删除不存在的 PPT 的题目，再按 PPT 重建不一致的条目
+	if repair.bankMissing || len(repair.missingDecks) > 0 {
+		if err := removeBankEntries(repair.missingDecks); err != nil {
+			return nil, err
+		}
+	}
+	for _, id := range repair.staleDecks {
+		UpdateBanks(id)
+	}
+	if len(repair.assets) > 0 {
+		cacheURLs(repair.assets)
+	}
+
+	// 修复后重新检查，剩下的才是真正没解决的问题
+	after, _, err := checkArchive(false)
+	if err != nil {
+		return nil, err
+	}
+	after.Fixed = len(report.Problems) - len(after.Problems)
+	if after.Fixed < 0 {
+		after.Fixed = 0
+	}
+	return after, nil
+}
+
+// checkArchive 检查存档，返回检查结果和可以自动修复的问题
+func checkArchive(forceAssets bool) (*FsckReport, *fsckRepair, error) {
+	report := &FsckReport{}
+	repair := &fsckRepair{}
+	ids, err := listDecks()
+	if err != nil {
+		return nil, nil, err
+	}
+	index, err := loadAssetIndex()
+	if err != nil {
+		report.add("图片索引: %v", err)
+		index = map[string]string{}
+	}
+	// 图片缓存是可选功能，从来没有启用过时不检查
+	if _, err := os.Stat(assetDir); os.IsNotExist(err) && !forceAssets {
+		report.AssetsSkipped = true
+	}
+
+	// 1. PPT 和快照都能解析，引用的图片都在缓存中
+	decks := map[string][]byte{}
+	refetch := map[string]bool{}
+	checkAssets := func(label string, data []byte) {
+		if report.AssetsSkipped {
+			return
+		}
+		for _, u := range deckAssets(data) {
+			name, ok := index[u]
+			if !ok {
+				report.add("%s: 图片未缓存 %s", label, u)
+				refetch[u] = true
+				continue
+			}
+			sum, err := hashFile(filepath.Join(assetDir, name))
+			if err != nil {
+				report.add("%s: 图片缓存文件缺失 %s", label, name)
+				refetch[u] = true
+				continue
+			}
+			if sum != assetHash(name) {
+				report.add("%s: 图片缓存文件哈希不匹配 %s", label, name)
+				refetch[u] = true
+			}
+			report.Assets++
+		}
+	}
+	for _, id := range ids {
+		data, err := os.ReadFile(deckPath(id))
+		if err == nil {
+			err = checkDeck(data)
+		}
+		if err != nil {
+			report.add("%s: PPT无法解析: %v", deckPath(id), err)
+			continue
+		}
+		report.Decks++
+		decks[id] = data
+		checkAssets(deckPath(id), data)
+
+		snapshots, err := listSnapshots(id)
+		if err != nil {
+			report.add("%s: %v", id, err)
+		}
+		for _, name := range snapshots {
+			file := filepath.Join(snapshotDir, id, name)
+			data, err := os.ReadFile(file)
+			if err == nil {
+				err = checkDeck(data)
+			}
+			if err != nil {
+				report.add("%s: 快照无法解析: %v", file, err)
+				continue
+			}
+			checkAssets(file, data)
+		}
+	}
+	for u := range refetch {
+		repair.assets = append(repair.assets, u)
+	}
+	sort.Strings(repair.assets)
+
+	// 2. 题库和 PPT 一致，题库不存在时当作空题库
+	var bank []map[string]interface{}
+	bankData, err := os.ReadFile(bankFilePath)
+	switch {
+	case os.IsNotExist(err):
+		report.add("%s不存在", bankFilePath)
+		repair.bankMissing = true
+	case err != nil:
+		return nil, nil, err
+	default:
+		if err := json.Unmarshal(bankData, &bank); err != nil {
+			report.add("%s无法解析: %v", bankFilePath, err)
+			sort.Strings(report.Problems)
+			return report, repair, nil
+		}
+	}
+	banked := map[string]map[string]map[string]interface{}{}
+	for _, qa := range bank {
+		presentationID, _ := qa["presentation_id"].(string)
+		problemID, _ := qa["problemId"].(string)
+		if banked[presentationID] == nil {
+			banked[presentationID] = map[string]map[string]interface{}{}
+		}
+		banked[presentationID][problemID] = qa
+	}
+
+	for id, data := range decks {
+		expected := map[string]bool{}
+		inconsistent := false
+		for _, qa := range deckProblems(id, data) {
+			problemID := qa["problemId"].(string)
+			expected[problemID] = true
+			got, ok := banked[id][problemID]
+			switch {
+			case !ok:
+				report.add("%s: 题目%s不在题库中", id, problemID)
+				inconsistent = true
+			case !sameBankEntry(got, qa):
+				report.add("%s: 题目%s与PPT不一致", id, problemID)
+				inconsistent = true
+			}
+		}
+		for problemID := range banked[id] {
+			if !expected[problemID] {
+				report.add("%s: 题库中的题目%s不在PPT中", id, problemID)
+				inconsistent = true
+			}
+		}
+		if inconsistent {
+			repair.staleDecks = append(repair.staleDecks, id)
+		}
+	}
+	sort.Strings(repair.staleDecks)
+	stored := map[string]bool{}
+	for _, id := range ids {
+		stored[id] = true
+	}
+	for id, problems := range banked {
+		if !stored[id] {
+			report.add("%s: 题库中有%d道题，但PPT不存在", id, len(problems))
+			repair.missingDecks = append(repair.missingDecks, id)
+		}
+	}
+
+	sort.Strings(report.Problems)
+	return report, repair, nil
+}
+
+// sameBankEntry 比较题库中的条目和按 PPT 生成的条目。题库是从 JSON 读出来的，
+// 数字都是 float64、选项是 map[string]interface{}，先把生成的条目也过一遍 JSON 再比较
+func sameBankEntry(got, want map[string]interface{}) bool {
+	data, err := json.Marshal(want)
+	if err != nil {
+		return false
+	}
+	var normalized map[string]interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return false
+	}
+	for key, value := range normalized {
+		if !reflect.DeepEqual(got[key], value) {
+			return false
+		}
+	}
+	return true
+}
+
+// removeBankEntries 从题库中删除指定 PPT 的题目，题库不存在时新建空题库
+func removeBankEntries(presentationIDs []string) error {
+	remove := map[string]bool{}
+	for _, id := range presentationIDs {
+		remove[id] = true
+	}
+	var bank []map[string]interface{}
+	bankData, err := os.ReadFile(bankFilePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		if err := json.Unmarshal(bankData, &bank); err != nil {
+			return err
+		}
+	}
+	kept := []map[string]interface{}{}
+	for _, qa := range bank {
+		if id, _ := qa["presentation_id"].(string); !remove[id] {
+			kept = append(kept, qa)
+		}
+	}
+	updatedData, err := json.MarshalIndent(kept, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(bankFilePath, updatedData, 0644)
+}
+
+// recentlyModified 文件是否在一小时内修改过，gc 不删除这些文件
+func recentlyModified(name string) bool {
+	info, err := os.Stat(name)
+	return err == nil && time.Since(info.ModTime()) < time.Hour
+}
+
+// GCPolicy 存档清理的保留策略
+type GCPolicy struct {
+	KeepSnapshots int           // 每个 PPT 至少保留的快照数量
+	MaxAge        time.Duration // 超过这个时间的快照会被删除，为 0 时不按时间删除
+	DryRun        bool          // 只列出要删除的文件
+}
+
+// GCReport 存档清理的结果
+type GCReport struct {
+	Removed       []string // 删除（或将要删除）的文件
+	AssetsSkipped bool     // 有 PPT 或快照无法解析，没有清理图片
+	Problems      []string
+}
+
+// ArchiveGC 函数功能：按保留策略删除过期快照、不再被引用的图片和写入中断留下的临时文件，
+// 有 PPT 或保留的快照无法解析时不清理图片，避免删掉它们引用的图片，
+// 参数：policy（GCPolicy），返回值：清理结果和 error
+func ArchiveGC(policy GCPolicy) (*GCReport, error) {
+	report := &GCReport{}
+	remove := func(name string) {
+		if !policy.DryRun {
+			if err := os.Remove(name); err != nil {
+				log.Println("Error removing file:", err)
+				return
+			}
+		}
+		report.Removed = append(report.Removed, name)
+	}
+
+	// 1. 写入中断留下的临时文件（一小时内的可能还在写，先不动），题库的临时文件在题库所在目录
+	patterns := []string{filepath.Join(filepath.Dir(bankFilePath), filepath.Base(bankFilePath)+".*.tmp")}
+	for _, pattern := range []string{"*.tmp", "*/*.tmp", "*/*/*.tmp"} {
+		patterns = append(patterns, filepath.Join(archiveDir, pattern))
+	}
+	for _, pattern := range patterns {
+		matches, _ := filepath.Glob(pattern)
+		for _, name := range matches {
+			if recentlyModified(name) {
+				continue
+			}
+			remove(name)
+		}
+	}
+
+	// 2. 过期快照，同时记下仍被引用的图片
+	ids, err := listDecks()
+	if err != nil {
+		return report, err
+	}
+	referenced := map[string]bool{}
+	reference := func(file, kind string) {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			err = checkDeck(data)
+		}
+		if err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf("%s: %s无法解析: %v", file, kind, err))
+			return
+		}
+		for _, u := range deckAssets(data) {
+			referenced[u] = true
+		}
+	}
+	for _, id := range ids {
+		reference(deckPath(id), "PPT")
+	}
+
+	entries, err := os.ReadDir(snapshotDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	now := time.Now()
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		id := entry.Name()
+		snapshots, err := listSnapshots(id)
+		if err != nil {
+			return report, err
+		}
+		for i, name := range snapshots {
+			file := filepath.Join(snapshotDir, id, name)
+			taken, err := snapshotTime(name)
+			expired := err == nil && policy.MaxAge > 0 && now.Sub(taken) > policy.MaxAge
+			if i >= policy.KeepSnapshots || expired {
+				remove(file)
+				continue
+			}
+			reference(file, "快照")
+		}
+		if !policy.DryRun {
+			os.Remove(filepath.Join(snapshotDir, id)) // 目录空了才会删除成功
+		}
+	}
+
+	// 3. 不再被引用的图片。有文件读不出来时不知道它引用了哪些图片，全部保留
+	if len(report.Problems) > 0 {
+		sort.Strings(report.Problems)
+		report.AssetsSkipped = true
+		return report, nil
+	}
+	assetMu.Lock()
+	defer assetMu.Unlock()
+	index, err := loadAssetIndex()
+	if err != nil {
+		return report, err
+	}
+	kept := map[string]bool{}
+	changed := false
+	for u, name := range index {
+		if referenced[u] {
+			if _, err := os.Stat(filepath.Join(assetDir, name)); err == nil {
+				kept[name] = true
+				continue
+			}
+		}
+		delete(index, u)
+		changed = true
+	}
+	assetEntries, err := os.ReadDir(assetDir)
+	if err != nil && !os.IsNotExist(err) {
+		return report, err
+	}
+	for _, entry := range assetEntries {
+		name := entry.Name()
+		if entry.IsDir() || name == filepath.Base(assetIndex) || strings.HasSuffix(name, ".tmp") || kept[name] {
+			continue
+		}
+		// 正在上课的进程可能刚下载完图片、还没写索引，gc 是另一个进程，锁不住它
+		if recentlyModified(filepath.Join(assetDir, name)) {
+			continue
+		}
+		remove(filepath.Join(assetDir, name))
+	}
+	if changed && !policy.DryRun {
+		if err := saveAssetIndex(index); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
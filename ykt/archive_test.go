@@ -0,0 +1,388 @@
+package ykt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeAsset 写入一张缓存图片并登记到索引，返回缓存文件名
+func writeAsset(t *testing.T, index map[string]string, u, content string) string {
+	t.Helper()
+	if err := os.MkdirAll(assetDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+	name := hex.EncodeToString(sum[:]) + ".png"
+	if err := os.WriteFile(filepath.Join(assetDir, name), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	index[u] = name
+	if err := saveAssetIndex(index); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// age 把文件的修改时间改到 d 之前
+func age(t *testing.T, name string, d time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-d)
+	if err := os.Chtimes(name, old, old); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeSnapshot(t *testing.T, presentationID string, taken time.Time, data string) string {
+	t.Helper()
+	dir := filepath.Join(snapshotDir, presentationID)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, taken.Format(snapshotTimeLayout)+".json")
+	if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.json")
+	if err := os.WriteFile(name, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFileAtomic(name, []byte("new"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(name)
+	if string(data) != "new" {
+		t.Errorf("content = %q, want %q", data, "new")
+	}
+	if info, _ := os.Stat(name); info.Mode().Perm() != 0600 {
+		t.Errorf("perm = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("temp file left behind: %v", entries)
+	}
+
+	// 目录不存在时失败，不留下任何文件
+	if err := writeFileAtomic(filepath.Join(dir, "missing", "b.json"), []byte("x"), 0644); err == nil {
+		t.Error("expected error for missing directory")
+	}
+}
+
+func TestSnapshotDeck(t *testing.T) {
+	chdirTemp(t)
+	v1 := `{"data":{"slides":[{"id":"s1"}]},"ts":1}`
+	v2 := `{"data":{"slides":[{"id":"s1"},{"id":"s2"}]},"ts":2}`
+
+	// 第一次保存没有旧版本
+	if err := snapshotDeck("p", []byte(v1)); err != nil {
+		t.Fatal(err)
+	}
+	writeDeck(t, "p", v1)
+	// 只有幻灯片以外的字段变化时不保留快照
+	if err := snapshotDeck("p", []byte(`{"data":{"slides":[{"id":"s1"}]},"ts":9}`)); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := listSnapshots("p"); len(names) != 0 {
+		t.Fatalf("unexpected snapshots: %v", names)
+	}
+
+	if err := snapshotDeck("p", []byte(v2)); err != nil {
+		t.Fatal(err)
+	}
+	names, _ := listSnapshots("p")
+	if len(names) != 1 {
+		t.Fatalf("snapshots = %v, want 1", names)
+	}
+	data, _ := os.ReadFile(filepath.Join(snapshotDir, "p", names[0]))
+	if string(data) != v1 {
+		t.Errorf("snapshot = %s, want old deck", data)
+	}
+
+	// 同一时刻的两次变化都要保留
+	writeDeck(t, "p", v2)
+	for i := 0; i < 2; i++ {
+		if err := snapshotDeck("p", []byte(v1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names, _ := listSnapshots("p"); len(names) != 3 {
+		t.Errorf("snapshots = %v, want 3", names)
+	}
+}
+
+func TestListSnapshotsOrder(t *testing.T) {
+	chdirTemp(t)
+	dir := filepath.Join(snapshotDir, "p")
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	// 以前按秒命名的快照和现在按纳秒命名的混在一起
+	for _, name := range []string{"20240101T100000.json", "20240101T100000.500000000.json", "20240101T095959.999999999.json", "20240102T000000.json"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("{}"), 0644)
+	}
+	names, err := listSnapshots("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"20240102T000000.json", "20240101T100000.500000000.json", "20240101T100000.json", "20240101T095959.999999999.json"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("snapshots = %v, want %v", names, want)
+	}
+}
+
+const fsckDeck = `{"data":{"slides":[
+	{"id":"s1","cover":"http://x/1.png"},
+	{"id":"s2","problem":{"problemId":"q1","body":"<p>1+1</p>","options":[]}}
+]}}`
+
+func TestArchiveFsck(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p1", fsckDeck)
+	writeDeck(t, "broken", `{"data":{"slides":[`)
+	name := writeAsset(t, map[string]string{}, "http://x/1.png", "image")
+	// 缓存文件内容被改坏
+	if err := os.WriteFile(filepath.Join(assetDir, name), []byte("corrupt"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bank := `[
+		{"presentation_id":"p1","problemId":"q1","question":"旧题干"},
+		{"presentation_id":"p1","problemId":"q9","question":"多余"},
+		{"presentation_id":"gone","problemId":"z","question":"?"}
+	]`
+	if err := os.WriteFile(bankFilePath, []byte(bank), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := ArchiveFsck(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"./ppts/broken.json: PPT无法解析",
+		"./ppts/p1.json: 图片缓存文件哈希不匹配 " + name,
+		"gone: 题库中有1道题，但PPT不存在",
+		"p1: 题库中的题目q9不在PPT中",
+		"p1: 题目q1与PPT不一致",
+	}
+	if len(report.Problems) != len(want) {
+		t.Fatalf("problems = %q", report.Problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(report.Problems[i], w) {
+			t.Errorf("problem %d = %q, want prefix %q", i, report.Problems[i], w)
+		}
+	}
+	if report.Decks != 1 || report.AssetsSkipped {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestArchiveFsckStaleAnswer(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p1", `{"data":{"slides":[{"id":"s1","problem":{"problemId":"q1","problemType":1,"body":"1+1",
+		"options":[{"key":"A","value":"2"},{"key":"B","value":"3"}],"answers":["A"]}}]}}`)
+	UpdateBanks("p1")
+	report, err := ArchiveFsck(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 {
+		t.Fatalf("fresh bank reported problems: %q", report.Problems)
+	}
+
+	for _, stale := range []string{
+		`"answers":["B"]`,
+		`"problemType":2`,
+		`"options":{"A":"2","B":"4"}`,
+	} {
+		bank := `[{"presentation_id":"p1","problemId":"q1","problemType":1,"question":"1+1",` +
+			`"answers":["A"],"options":{"A":"2","B":"3"},` + stale + `}]`
+		if err := os.WriteFile(bankFilePath, []byte(bank), 0644); err != nil {
+			t.Fatal(err)
+		}
+		report, err := ArchiveFsck(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Problems) != 1 || !strings.HasPrefix(report.Problems[0], "p1: 题目q1与PPT不一致") {
+			t.Errorf("%s: problems = %q", stale, report.Problems)
+		}
+	}
+}
+
+func TestArchiveFsckFixBank(t *testing.T) {
+	chdirTemp(t)
+	// 只检查题库，不涉及图片缓存
+	writeDeck(t, "p1", `{"data":{"slides":[{"id":"s2","problem":{"problemId":"q1","body":"<p>1+1</p>"}}]}}`)
+
+	// 题库不存在时当作空题库，只算一个问题加缺失的题目
+	report, err := ArchiveFsck(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 2 || !report.AssetsSkipped {
+		t.Fatalf("report = %+v", report)
+	}
+
+	bank := `[{"presentation_id":"gone","problemId":"z","question":"?"}]`
+	if err := os.WriteFile(bankFilePath, []byte(bank), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report, err = ArchiveFsck(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 || report.Fixed != 2 {
+		t.Fatalf("after fix: %+v", report)
+	}
+
+	var entries []map[string]interface{}
+	data, _ := os.ReadFile(bankFilePath)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0]["presentation_id"] != "p1" || entries[0]["question"] != "1+1" {
+		t.Errorf("bank = %s", data)
+	}
+}
+
+func TestArchiveGC(t *testing.T) {
+	chdirTemp(t)
+	deck := `{"data":{"slides":[{"id":"s1","cover":"http://x/current.png"}]}}`
+	writeDeck(t, "p", deck)
+
+	index := map[string]string{}
+	current := writeAsset(t, index, "http://x/current.png", "current")
+	kept := writeAsset(t, index, "http://x/kept.png", "kept")
+	dropped := writeAsset(t, index, "http://x/dropped.png", "dropped")
+	expired := writeAsset(t, index, "http://x/expired.png", "expired")
+	for _, name := range []string{current, kept, dropped, expired} {
+		age(t, filepath.Join(assetDir, name), 2*time.Hour)
+	}
+	// 刚下载、还没登记到索引的图片不能删
+	fresh := filepath.Join(assetDir, "fresh.png")
+	os.WriteFile(fresh, []byte("fresh"), 0644)
+	orphan := filepath.Join(assetDir, "orphan.png")
+	os.WriteFile(orphan, []byte("orphan"), 0644)
+	age(t, orphan, 2*time.Hour)
+
+	now := time.Now()
+	snap := func(days int, cover string) string {
+		return writeSnapshot(t, "p", now.AddDate(0, 0, -days), `{"data":{"slides":[{"id":"s1","cover":"`+cover+`"}]}}`)
+	}
+	newest := snap(1, "http://x/kept.png")
+	second := snap(2, "http://x/kept.png")
+	third := snap(3, "http://x/dropped.png")
+	old := snap(40, "http://x/expired.png")
+
+	// 写入中断留下的临时文件，包括题库所在目录下的
+	staleTmp := []string{"bank.json.123.tmp", filepath.Join(archiveDir, "p.json.456.tmp")}
+	for _, name := range staleTmp {
+		os.WriteFile(name, []byte("x"), 0644)
+		age(t, name, 2*time.Hour)
+	}
+	freshTmp := "bank.json.789.tmp"
+	os.WriteFile(freshTmp, []byte("x"), 0644)
+
+	policy := GCPolicy{KeepSnapshots: 2, MaxAge: 30 * 24 * time.Hour}
+	dry, err := ArchiveGC(GCPolicy{KeepSnapshots: policy.KeepSnapshots, MaxAge: policy.MaxAge, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists(third) || !exists(orphan) {
+		t.Fatal("dry run removed files")
+	}
+
+	report, err := ArchiveGC(policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Problems) != 0 || report.AssetsSkipped {
+		t.Fatalf("report = %+v", report)
+	}
+	removed := report.Removed
+	want := []string{
+		third, old,
+		filepath.Join(assetDir, dropped), filepath.Join(assetDir, expired), orphan,
+	}
+	for _, name := range staleTmp {
+		want = append(want, filepath.Clean(name))
+	}
+	clean := func(list []string) []string {
+		out := make([]string, len(list))
+		for i, name := range list {
+			out[i] = filepath.Clean(name)
+		}
+		sort.Strings(out)
+		return out
+	}
+	if got, w := clean(removed), clean(want); strings.Join(got, "\n") != strings.Join(w, "\n") {
+		t.Errorf("removed:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(w, "\n"))
+	}
+	if got := clean(dry.Removed); strings.Join(got, "\n") != strings.Join(clean(removed), "\n") {
+		t.Errorf("dry run listed:\n%s", strings.Join(got, "\n"))
+	}
+
+	for _, name := range []string{newest, second, fresh, freshTmp, filepath.Join(assetDir, current), filepath.Join(assetDir, kept)} {
+		if !exists(name) {
+			t.Errorf("%s should be kept", name)
+		}
+	}
+	index, err = loadAssetIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 2 || index["http://x/current.png"] != current || index["http://x/kept.png"] != kept {
+		t.Errorf("index = %v", index)
+	}
+}
+
+func TestArchiveGCCorruptDeck(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p", `{"data":{"slides":[{"id":"s1","cover":"http://x/a.png"}]}}`)
+	writeDeck(t, "broken", `{"data":{"slides":[`)
+	index := map[string]string{}
+	used := writeAsset(t, index, "http://x/a.png", "a")
+	unknown := writeAsset(t, index, "http://x/b.png", "b")
+	kept := writeSnapshot(t, "q", time.Now(), `{"data":`)
+	for _, name := range []string{used, unknown} {
+		age(t, filepath.Join(assetDir, name), 2*time.Hour)
+	}
+
+	report, err := ArchiveGC(GCPolicy{KeepSnapshots: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 不知道损坏的 PPT 和快照引用了哪些图片，一张都不删
+	if !report.AssetsSkipped || len(report.Removed) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+	want := []string{"./ppts/broken.json: PPT无法解析", kept + ": 快照无法解析"}
+	if len(report.Problems) != len(want) {
+		t.Fatalf("problems = %q", report.Problems)
+	}
+	for i, w := range want {
+		if !strings.HasPrefix(report.Problems[i], w) {
+			t.Errorf("problem %d = %q, want prefix %q", i, report.Problems[i], w)
+		}
+	}
+	if !exists(filepath.Join(assetDir, unknown)) {
+		t.Error("unreferenced asset removed while a deck is corrupt")
+	}
+}
@@ -0,0 +1,122 @@
+package ykt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/tidwall/gjson"
+)
+
+// ExportMarkdown 函数功能：把保存的 PPT 连同个人批注导出成 Markdown，参数：presentationID（string），返回值：Markdown 文本和 error
+func ExportMarkdown(presentationID string) (string, error) {
+	_, markdown, err := exportDeck(presentationID)
+	return markdown, err
+}
+
+// ExportHTML 函数功能：把导出的 Markdown 转成可直接打开或打印的 HTML 页面，参数：presentationID（string），返回值：HTML 文本和 error
+func ExportHTML(presentationID string) (string, error) {
+	title, markdown, err := exportDeck(presentationID)
+	if err != nil {
+		return "", err
+	}
+	return htmlPage(title, markdownHTML(markdown)), nil
+}
+
+// ExportPDF 函数功能：把导出的 Markdown 排版成 PDF（只含文字，图片显示为“[图片]”），参数：presentationID（string），返回值：PDF 文件内容和 error
+func ExportPDF(presentationID string) ([]byte, error) {
+	title, markdown, err := exportDeck(presentationID)
+	if err != nil {
+		return nil, err
+	}
+	return markdownPDF(title, markdown), nil
+}
+
+// exportDeck 把 PPT 和批注整理成 Markdown，HTML、PDF 导出都在此基础上转换
+func exportDeck(presentationID string) (string, string, error) {
+	data, err := os.ReadFile(deckPath(presentationID))
+	if err != nil {
+		return "", "", err
+	}
+	if err := checkDeck(data); err != nil {
+		return "", "", fmt.Errorf("PPT %s 内容异常: %v", presentationID, err)
+	}
+	notes, err := LoadNotes(presentationID)
+	if err != nil {
+		return "", "", err
+	}
+
+	var b strings.Builder
+	title := gjson.GetBytes(data, "data.title").String()
+	if title == "" {
+		title = presentationID
+	}
+	b.WriteString("# " + RenderMarkdown(title) + "\n\n")
+
+	gjson.GetBytes(data, "data.slides").ForEach(func(_, slide gjson.Result) bool {
+		sid := slide.Get("id").String()
+		b.WriteString(fmt.Sprintf("## 第%d页\n\n", slide.Get("index").Int()))
+		if cover := slide.Get("cover").String(); cover != "" {
+			b.WriteString(fmt.Sprintf("![](%s)\n\n", urlEscaper.Replace(cover)))
+		}
+		if problem := slide.Get("problem"); problem.Exists() {
+			b.WriteString(problemMarkdown(problem))
+		}
+		if note, ok := notes[sid]; ok {
+			b.WriteString(notesSection(note))
+			delete(notes, sid)
+		}
+		return true
+	})
+
+	// 剩下的是已经找不到幻灯片的批注，附在最后
+	if len(notes) > 0 {
+		b.WriteString("## 其他批注\n\n")
+		for _, note := range SortNotes(notes) {
+			b.WriteString(fmt.Sprintf("#### 幻灯片 %s\n\n", note.Sid))
+			b.WriteString(NoteMarkdown(note) + "\n\n")
+		}
+	}
+	return RenderText(title), strings.TrimSpace(b.String()) + "\n", nil
+}
+
+// problemMarkdown 输出题干、选项和答案
+func problemMarkdown(problem gjson.Result) string {
+	var b strings.Builder
+	if body := RenderMarkdown(problem.Get("body").String()); body != "" {
+		b.WriteString(body + "\n\n")
+	}
+	problem.Get("options").ForEach(func(_, option gjson.Result) bool {
+		b.WriteString(fmt.Sprintf("- **%s.** %s\n", option.Get("key").String(), RenderMarkdown(option.Get("value").String())))
+		return true
+	})
+	if problem.Get("options").IsArray() && len(problem.Get("options").Array()) > 0 {
+		b.WriteString("\n")
+	}
+
+	answers := problem.Get("answers")
+	if !answers.Exists() {
+		answers = problem.Get("result")
+	}
+	var list []string
+	if answers.IsArray() {
+		for _, answer := range answers.Array() {
+			list = append(list, answer.String())
+		}
+	} else if answers.Exists() && answers.String() != "" {
+		list = append(list, answers.String())
+	}
+	if len(list) > 0 {
+		b.WriteString("**答案：** " + RenderMarkdown(strings.Join(list, "、")) + "\n\n")
+	}
+	return b.String()
+}
+
+// notesSection 输出一张幻灯片的批注
+func notesSection(note *Note) string {
+	text := NoteMarkdown(note)
+	if text == "" {
+		return ""
+	}
+	return "#### 我的批注\n\n" + text + "\n\n"
+}
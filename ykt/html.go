@@ -0,0 +1,341 @@
+package ykt
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// 把导出的 Markdown 转成 HTML。只需要支持 RenderMarkdown 和 NoteMarkdown 会输出的语法：
+// 标题、段落、列表、引用、表格、代码、图片、链接、强调和公式
+
+var (
+	headingPattern   = regexp.MustCompile(`^(#{1,6}) (.*)$`)
+	listItemPattern  = regexp.MustCompile(`^( *)([-+*]|[0-9]+\.) (.*)$`)
+	tableSepPattern  = regexp.MustCompile(`^\|(?: *:?-+:? *\|)+$`)
+	entityPattern    = regexp.MustCompile(`^&(?:[a-zA-Z]+|#[0-9]+|#[xX][0-9a-fA-F]+);`)
+	inlineTagPattern = regexp.MustCompile(`^</?(?:sub|sup)>`)
+	// 只在 $ 处尝试匹配公式，规则与 render 中的一致
+	inlineMathPattern = regexp.MustCompile(`^(?:` + mathPattern.String() + `)`)
+)
+
+// htmlPage 生成完整的 HTML 页面，打印时每页不会截断图片
+func htmlPage(title, body string) string {
+	return `<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<title>` + html.EscapeString(title) + `</title>
+<style>
+body { max-width: 860px; margin: 2em auto; padding: 0 1em; font-family: sans-serif; line-height: 1.6; }
+img { max-width: 100%; }
+blockquote { margin: 0 0 1em; padding: 0 1em; border-left: 4px solid #ddd; color: #555; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+pre { background: #f6f8fa; padding: 8px; overflow-x: auto; }
+mark { background: #fff3a3; }
+@media print { body { max-width: none; margin: 0; } img, pre, table { page-break-inside: avoid; } }
+</style>
+<script src="https://cdn.jsdelivr.net/npm/mathjax@3/es5/tex-mml-chtml.js" async></script>
+</head>
+<body>
+` + body + `</body>
+</html>
+`
+}
+
+// markdownHTML 把 Markdown 转成 HTML 片段
+func markdownHTML(markdown string) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case strings.TrimSpace(line) == "":
+			i++
+		case strings.HasPrefix(line, "```"):
+			fence := line[:len(line)-len(strings.TrimLeft(line, "`"))]
+			var code []string
+			for i++; i < len(lines) && !isClosingFence(lines[i], fence); i++ {
+				code = append(code, lines[i])
+			}
+			i++
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			b.WriteString(fmt.Sprintf("<h%d>%s</h%d>\n", len(m[1]), inlineHTML(m[2]), len(m[1])))
+			i++
+		case strings.HasPrefix(line, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(lines[i], ">"); i++ {
+				quoted = append(quoted, strings.TrimPrefix(strings.TrimPrefix(lines[i], ">"), " "))
+			}
+			b.WriteString("<blockquote>\n" + markdownHTML(strings.Join(quoted, "\n")) + "</blockquote>\n")
+		case strings.HasPrefix(line, "|"):
+			var rows []string
+			for ; i < len(lines) && strings.HasPrefix(lines[i], "|"); i++ {
+				rows = append(rows, lines[i])
+			}
+			b.WriteString(tableHTML(rows))
+		case listItemPattern.MatchString(line):
+			var items []string
+			for ; i < len(lines) && (listItemPattern.MatchString(lines[i]) || strings.HasPrefix(lines[i], "  ") && strings.TrimSpace(lines[i]) != ""); i++ {
+				items = append(items, lines[i])
+			}
+			b.WriteString(listHTML(items))
+		default:
+			var para []string
+			for ; i < len(lines) && strings.TrimSpace(lines[i]) != "" && !startsBlock(lines[i]); i++ {
+				para = append(para, inlineHTML(lines[i]))
+			}
+			b.WriteString("<p>" + strings.Join(para, "<br>\n") + "</p>\n")
+		}
+	}
+	return b.String()
+}
+
+func isClosingFence(line, fence string) bool {
+	line = strings.TrimSpace(line)
+	return len(line) >= len(fence) && strings.Trim(line, "`") == ""
+}
+
+// startsBlock 判断一行是否开始新的块，用来结束段落
+func startsBlock(line string) bool {
+	return strings.HasPrefix(line, "```") || strings.HasPrefix(line, ">") || strings.HasPrefix(line, "|") ||
+		headingPattern.MatchString(line) || listItemPattern.MatchString(line)
+}
+
+// listHTML 输出列表，缩进更深的行属于上一项的子列表
+func listHTML(lines []string) string {
+	first := listItemPattern.FindStringSubmatch(lines[0])
+	indent := len(first[1])
+	tag := "ul"
+	if first[2] != "-" && first[2] != "+" && first[2] != "*" {
+		tag = "ol"
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + tag + ">\n")
+	for i := 0; i < len(lines); {
+		m := listItemPattern.FindStringSubmatch(lines[i])
+		text := strings.TrimSpace(lines[i])
+		if m != nil && len(m[1]) <= indent {
+			text = m[3]
+		}
+		i++
+		var nested []string
+		for ; i < len(lines); i++ {
+			if m := listItemPattern.FindStringSubmatch(lines[i]); m != nil && len(m[1]) <= indent {
+				break
+			}
+			nested = append(nested, lines[i])
+		}
+		b.WriteString("<li>" + inlineHTML(text))
+		if len(nested) > 0 {
+			b.WriteString("\n" + markdownHTML(dedent(nested, indent+2)))
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString("</" + tag + ">\n")
+	return b.String()
+}
+
+func dedent(lines []string, n int) string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if len(line)-len(trimmed) > n {
+			trimmed = line[n:]
+		}
+		out[i] = trimmed
+	}
+	return strings.Join(out, "\n")
+}
+
+// tableHTML 输出表格，第一行是表头，分隔行跳过
+func tableHTML(rows []string) string {
+	var b strings.Builder
+	b.WriteString("<table>\n")
+	for i, row := range rows {
+		if tableSepPattern.MatchString(row) {
+			continue
+		}
+		cell := "td"
+		if i == 0 {
+			cell = "th"
+		}
+		b.WriteString("<tr>")
+		for _, text := range splitCells(row) {
+			b.WriteString("<" + cell + ">" + inlineHTML(strings.TrimSpace(text)) + "</" + cell + ">")
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</table>\n")
+	return b.String()
+}
+
+// splitCells 按没有转义的 | 拆分表格行
+func splitCells(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var cells []string
+	start := 0
+	for i := 0; i < len(row); i++ {
+		switch row[i] {
+		case '\\':
+			i++
+		case '|':
+			cells = append(cells, row[start:i])
+			start = i + 1
+		}
+	}
+	return append(cells, row[start:])
+}
+
+// inlineHTML 转换一行内的 Markdown 语法，其余字符按 HTML 转义
+func inlineHTML(s string) string {
+	var b strings.Builder
+	var open []string // 未闭合的强调标签
+	toggle := func(tag string) {
+		if n := len(open); n > 0 && open[n-1] == tag {
+			open = open[:n-1]
+			b.WriteString("</" + tag + ">")
+			return
+		}
+		open = append(open, tag)
+		b.WriteString("<" + tag + ">")
+	}
+
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_[]{}()#+-.!|<>~=$&", rune(rest[1])):
+			b.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+		case rest[0] == '`':
+			fence := rest[:len(rest)-len(strings.TrimLeft(rest, "`"))]
+			end := closingBackticks(rest[len(fence):], len(fence))
+			if end < 0 {
+				b.WriteString(fence)
+				i += len(fence)
+				break
+			}
+			code := rest[len(fence) : len(fence)+end]
+			if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' {
+				code = code[1 : len(code)-1]
+			}
+			b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+			i += len(fence)*2 + end
+		case rest[0] == '$':
+			m := inlineMathPattern.FindStringSubmatch(rest)
+			// 与 render 一样，紧跟数字的 $ 不当作公式结尾
+			if m == nil || m[3] != "" && len(rest) > len(m[0]) && rest[len(m[0])] >= '0' && rest[len(m[0])] <= '9' {
+				b.WriteString("$")
+				i++
+				break
+			}
+			if m[1] != "" || m[2] != "" {
+				b.WriteString(`\[` + html.EscapeString(m[1]+m[2]) + `\]`)
+			} else {
+				b.WriteString(`\(` + html.EscapeString(m[3]+m[4]) + `\)`)
+			}
+			i += len(m[0])
+		case strings.HasPrefix(rest, "!["):
+			text, url, n := parseLink(rest[1:])
+			if n < 0 {
+				b.WriteString("!")
+				i++
+				break
+			}
+			b.WriteString(fmt.Sprintf(`<img src="%s" alt="%s">`, html.EscapeString(url), html.EscapeString(RenderText(inlineHTML(text)))))
+			i += 1 + n
+		case rest[0] == '[':
+			text, url, n := parseLink(rest)
+			if n < 0 {
+				b.WriteString("[")
+				i++
+				break
+			}
+			b.WriteString(fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(url), inlineHTML(text)))
+			i += n
+		case strings.HasPrefix(rest, "**"):
+			toggle("strong")
+			i += 2
+		case strings.HasPrefix(rest, "~~"):
+			toggle("del")
+			i += 2
+		case strings.HasPrefix(rest, "=="):
+			toggle("mark")
+			i += 2
+		case rest[0] == '*':
+			toggle("em")
+			i++
+		case rest[0] == '<' && inlineTagPattern.MatchString(rest):
+			tag := inlineTagPattern.FindString(rest)
+			b.WriteString(tag)
+			i += len(tag)
+		case rest[0] == '&' && entityPattern.MatchString(rest):
+			entity := entityPattern.FindString(rest)
+			b.WriteString(entity)
+			i += len(entity)
+		default:
+			b.WriteString(html.EscapeString(rest[:1]))
+			i++
+		}
+	}
+	for n := len(open) - 1; n >= 0; n-- {
+		b.WriteString("</" + open[n] + ">")
+	}
+	return b.String()
+}
+
+// closingBackticks 查找长度正好为 n 的反引号，返回其位置，找不到时返回 -1
+func closingBackticks(s string, n int) int {
+	for i := 0; i < len(s); {
+		if s[i] != '`' {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && s[j] == '`' {
+			j++
+		}
+		if j-i == n {
+			return i
+		}
+		i = j
+	}
+	return -1
+}
+
+// parseLink 解析 [文字](地址)，返回文字、地址和消耗的长度，不是链接时长度为 -1
+func parseLink(s string) (string, string, int) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth > 0 {
+				continue
+			}
+			if !strings.HasPrefix(s[i+1:], "(") {
+				return "", "", -1
+			}
+			end := strings.IndexByte(s[i+2:], ')')
+			if end < 0 {
+				return "", "", -1
+			}
+			url := strings.Trim(s[i+2:i+2+end], "<>")
+			return s[1:i], url, i + 3 + end
+		}
+	}
+	return "", "", -1
+}
@@ -0,0 +1,236 @@
+package ykt
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tidwall/gjson"
+)
+
+// 个人批注：按 PPT 编号和幻灯片编号（sid）保存笔记、划线和标签。
+// 批注单独存放在 ./ppts/<presentationID>.notes.json，PPT 重新获取时不会被覆盖，
+// 之后按 sid 重新挂回到幻灯片上。
+
+// Note 一张幻灯片（或一道题）上的批注
+type Note struct {
+	Sid        string   `json:"sid"`
+	ProblemId  string   `json:"problemId,omitempty"`
+	SlideIndex int      `json:"slideIndex"`           // 幻灯片序号，从 1 开始，重新挂载时更新
+	Text       string   `json:"text,omitempty"`       // 笔记内容
+	Highlights []string `json:"highlights,omitempty"` // 划线的原文片段
+	Tags       []string `json:"tags,omitempty"`
+	Orphaned   bool     `json:"orphaned,omitempty"` // 最新的 PPT 中已找不到这张幻灯片
+	UpdatedAt  string   `json:"updatedAt"`
+}
+
+// NotesPath 返回某个 PPT 的批注文件路径
+func NotesPath(presentationID string) string {
+	return fmt.Sprintf("%s/%s.notes.json", archiveDir, presentationID)
+}
+
+// LoadNotes 函数功能：读取 PPT 的批注，参数：presentationID（string），返回值：以 sid 为键的批注
+func LoadNotes(presentationID string) (map[string]*Note, error) {
+	notes := map[string]*Note{}
+	data, err := os.ReadFile(NotesPath(presentationID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return notes, nil
+		}
+		return nil, err
+	}
+	var list []*Note
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("解析批注文件失败: %v", err)
+	}
+	for _, note := range list {
+		notes[note.Sid] = note
+	}
+	return notes, nil
+}
+
+// SortNotes 函数功能：按幻灯片顺序排列批注，参数：notes，返回值：[]*Note
+func SortNotes(notes map[string]*Note) []*Note {
+	list := make([]*Note, 0, len(notes))
+	for _, note := range notes {
+		list = append(list, note)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].SlideIndex != list[j].SlideIndex {
+			return list[i].SlideIndex < list[j].SlideIndex
+		}
+		return list[i].Sid < list[j].Sid
+	})
+	return list
+}
+
+// SaveNotes 函数功能：保存 PPT 的批注，按幻灯片顺序写入，参数：presentationID（string）、notes，返回值：error
+func SaveNotes(presentationID string, notes map[string]*Note) error {
+	data, err := json.MarshalIndent(SortNotes(notes), "", "    ")
+	if err != nil {
+		return err
+	}
+	// 子命令不会执行 InitFiles，ppts 目录可能还不存在
+	if err := os.MkdirAll(archiveDir, os.ModePerm); err != nil {
+		return err
+	}
+	return writeFileAtomic(NotesPath(presentationID), data, 0644)
+}
+
+// AddNote 函数功能：给幻灯片追加笔记、划线和标签，参数：presentationID、sid、text、highlights、tags，返回值：更新后的批注和 error
+func AddNote(presentationID, sid, text string, highlights, tags []string) (*Note, error) {
+	notes, err := LoadNotes(presentationID)
+	if err != nil {
+		return nil, err
+	}
+	// PPT 已经保存过时顺便定位幻灯片；新批注找不到幻灯片时多半是 sid 写错了，不保存
+	slides, err := loadSlides(presentationID)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	note, ok := notes[sid]
+	if !ok {
+		if _, found := slides[sid]; slides != nil && !found {
+			return nil, fmt.Errorf("编号为%s的PPT中没有幻灯片%s", presentationID, sid)
+		}
+		note = &Note{Sid: sid}
+		notes[sid] = note
+	}
+	if text != "" {
+		if note.Text != "" {
+			note.Text += "\n\n"
+		}
+		note.Text += text
+	}
+	note.Highlights = appendUnique(note.Highlights, highlights...)
+	note.Tags = appendUnique(note.Tags, tags...)
+	note.UpdatedAt = time.Now().Format(time.RFC3339)
+
+	if slides != nil {
+		attachNote(note, slides)
+	}
+	return note, SaveNotes(presentationID, notes)
+}
+
+// DeleteNote 函数功能：删除幻灯片上的全部批注，参数：presentationID、sid，返回值：error
+func DeleteNote(presentationID, sid string) error {
+	notes, err := LoadNotes(presentationID)
+	if err != nil {
+		return err
+	}
+	if _, ok := notes[sid]; !ok {
+		return fmt.Errorf("幻灯片%s上没有批注", sid)
+	}
+	delete(notes, sid)
+	if len(notes) == 0 {
+		return os.Remove(NotesPath(presentationID))
+	}
+	return SaveNotes(presentationID, notes)
+}
+
+// ReattachNotes 函数功能：PPT 重新获取后按 sid 把批注挂回幻灯片，参数：presentationID（string），返回值：无
+func ReattachNotes(presentationID string) {
+	notes, err := LoadNotes(presentationID)
+	if err != nil {
+		log.Println("Error reading notes:", err)
+		return
+	}
+	if len(notes) == 0 {
+		return
+	}
+	slides, err := loadSlides(presentationID)
+	if err != nil {
+		log.Println("Error reading file:", err)
+		return
+	}
+
+	orphaned := 0
+	for _, note := range notes {
+		attachNote(note, slides)
+		if note.Orphaned {
+			orphaned++
+		}
+	}
+	if err := SaveNotes(presentationID, notes); err != nil {
+		log.Println("Error writing notes:", err)
+		return
+	}
+	if orphaned > 0 {
+		log.Printf("-----------编号为%s的PPT有%d条批注找不到对应的幻灯片，已保留------------\n", presentationID, orphaned)
+	}
+}
+
+// loadSlides 读取已保存的 PPT，返回以 sid 为键的幻灯片
+func loadSlides(presentationID string) (map[string]gjson.Result, error) {
+	fileData, err := os.ReadFile(deckPath(presentationID))
+	if err != nil {
+		return nil, err
+	}
+	slides := map[string]gjson.Result{}
+	gjson.GetBytes(fileData, "data.slides").ForEach(func(_, slide gjson.Result) bool {
+		slides[slide.Get("id").String()] = slide
+		return true
+	})
+	return slides, nil
+}
+
+// attachNote 用最新的幻灯片信息更新批注的位置
+func attachNote(note *Note, slides map[string]gjson.Result) {
+	slide, ok := slides[note.Sid]
+	if !ok {
+		note.Orphaned = true
+		return
+	}
+	note.Orphaned = false
+	note.SlideIndex = int(slide.Get("index").Int())
+	note.ProblemId = slide.Get("problem.problemId").String()
+}
+
+// NoteMarkdown 函数功能：把批注渲染成 Markdown，供各种导出复用，参数：note（*Note），返回值：Markdown 文本
+func NoteMarkdown(note *Note) string {
+	if note == nil {
+		return ""
+	}
+	var b strings.Builder
+	if len(note.Tags) > 0 {
+		tags := make([]string, len(note.Tags))
+		for i, tag := range note.Tags {
+			tags[i] = "`#" + tag + "`"
+		}
+		b.WriteString("标签：" + strings.Join(tags, " ") + "\n\n")
+	}
+	for _, highlight := range note.Highlights {
+		b.WriteString("> ==" + highlight + "==\n\n")
+	}
+	if note.Text != "" {
+		b.WriteString(note.Text + "\n\n")
+	}
+	if note.Orphaned {
+		b.WriteString("*（原幻灯片已不存在）*\n\n")
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func appendUnique(list []string, items ...string) []string {
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		exists := false
+		for _, v := range list {
+			if v == item {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -0,0 +1,265 @@
+package ykt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// chdirTemp 切换到临时目录，测试结束后切回
+func chdirTemp(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return dir
+}
+
+// writeDeck 写入一个测试用的 PPT
+func writeDeck(t *testing.T, presentationID, data string) {
+	t.Helper()
+	if err := os.MkdirAll(archiveDir, os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(deckPath(presentationID), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const noteDeck = `{"data":{"title":"第一章","slides":[
+	{"id":"s1","index":1,"cover":"http://x/1.png"},
+	{"id":"s2","index":2,"problem":{"problemId":"p2","body":"<p>1+1=?</p>","options":[{"key":"A","value":"2"},{"key":"B","value":"3"}],"answers":["A"]}},
+	{"id":"s3","index":3}
+]}}`
+
+func TestAddNoteCreatesArchiveDir(t *testing.T) {
+	chdirTemp(t)
+
+	note, err := AddNote("p", "s1", "笔记", nil, []string{"重点", " 重点 "})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 还没有保存 PPT 时无法定位，也不算找不到幻灯片
+	if note.Orphaned || note.SlideIndex != 0 {
+		t.Errorf("note without a stored deck should stay unattached: %+v", note)
+	}
+	if len(note.Tags) != 1 {
+		t.Errorf("tags = %v, want one unique tag", note.Tags)
+	}
+	if _, err := os.Stat(NotesPath("p")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAddNoteUnknownSlide(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p", noteDeck)
+
+	if _, err := AddNote("p", "s9", "笔记", nil, nil); err == nil {
+		t.Fatal("expected error for unknown slide")
+	}
+	if _, err := os.Stat(NotesPath("p")); !os.IsNotExist(err) {
+		t.Errorf("notes file should not be written: %v", err)
+	}
+
+	// 已经失去幻灯片的批注仍然可以继续补充
+	if err := SaveNotes("p", map[string]*Note{"s9": {Sid: "s9", Text: "旧笔记", Orphaned: true}}); err != nil {
+		t.Fatal(err)
+	}
+	note, err := AddNote("p", "s9", "补充", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !note.Orphaned || note.Text != "旧笔记\n\n补充" {
+		t.Errorf("note = %+v", note)
+	}
+}
+
+func TestReattachNotes(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p", noteDeck)
+
+	for _, sid := range []string{"s2", "s3"} {
+		if _, err := AddNote("p", sid, "笔记"+sid, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	notes, err := LoadNotes("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := notes["s2"]; n.SlideIndex != 2 || n.ProblemId != "p2" || n.Orphaned {
+		t.Fatalf("s2 not attached: %+v", n)
+	}
+
+	// 重新获取后 s2 挪到第 1 页，s3 被删除
+	writeDeck(t, "p", `{"data":{"slides":[
+		{"id":"s2","index":1,"problem":{"problemId":"p2"}},
+		{"id":"s4","index":2}
+	]}}`)
+	ReattachNotes("p")
+
+	notes, err = LoadNotes("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := notes["s2"]; n.SlideIndex != 1 || n.Orphaned || n.Text != "笔记s2" {
+		t.Errorf("s2 not re-indexed: %+v", n)
+	}
+	if n := notes["s3"]; !n.Orphaned || n.Text != "笔记s3" {
+		t.Errorf("s3 should be kept as orphaned: %+v", n)
+	}
+
+	// 幻灯片恢复后重新挂上
+	writeDeck(t, "p", noteDeck)
+	ReattachNotes("p")
+	notes, _ = LoadNotes("p")
+	if n := notes["s3"]; n.Orphaned || n.SlideIndex != 3 {
+		t.Errorf("s3 not re-attached: %+v", n)
+	}
+}
+
+func TestExportMarkdown(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p", noteDeck)
+	if _, err := AddNote("p", "s2", "易错", []string{"1+1"}, []string{"期末"}); err != nil {
+		t.Fatal(err)
+	}
+	// 批注所在的幻灯片 s3 在重新获取后被删除
+	if _, err := AddNote("p", "s3", "旧笔记", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	writeDeck(t, "p", strings.Replace(noteDeck, `,
+	{"id":"s3","index":3}`, "", 1))
+	ReattachNotes("p")
+
+	got, err := ExportMarkdown("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"# 第一章\n",
+		"## 第1页\n\n![](http://x/1.png)",
+		"## 第2页\n\n1+1=?\n\n- **A.** 2\n- **B.** 3\n\n**答案：** A\n\n#### 我的批注\n\n标签：`#期末`\n\n> ==1+1==\n\n易错",
+		"## 其他批注\n\n#### 幻灯片 s3\n\n旧笔记\n\n*（原幻灯片已不存在）*",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("export missing %q\n%s", want, got)
+		}
+	}
+}
+
+func TestExportHTML(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p", noteDeck)
+	if _, err := AddNote("p", "s2", "易错 <b>", []string{"1+1"}, []string{"期末"}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ExportHTML("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>第一章</title>",
+		"<h1>第一章</h1>",
+		`<p><img src="http://x/1.png" alt=""></p>`,
+		"<li><strong>A.</strong> 2</li>",
+		"<p><strong>答案：</strong> A</p>",
+		"<h4>我的批注</h4>\n<p>标签：<code>#期末</code></p>\n<blockquote>\n<p><mark>1+1</mark></p>\n</blockquote>\n<p>易错 &lt;b&gt;</p>",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("export missing %q\n%s", want, got)
+		}
+	}
+}
+
+func TestMarkdownHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"paragraph", "a\nb\n\nc", "<p>a<br>\nb</p>\n<p>c</p>\n"},
+		{"escapes", `\# 1\. a\*b\|c`, "<p># 1. a*b|c</p>\n"},
+		{"emphasis", "**粗***斜*~~删~~", "<p><strong>粗</strong><em>斜</em><del>删</del></p>\n"},
+		{"math", "设 $a < b$ 价格 $5 和 $10 $$x$$", `<p>设 \(a &lt; b\) 价格 $5 和 $10 \[x\]</p>` + "\n"},
+		{"code", "`` a`b `` <sub>2</sub>", "<p><code>a`b</code> <sub>2</sub></p>\n"},
+		{"link", `[链\[1\]](http://x/a%20b)`, `<p><a href="http://x/a%20b">链[1]</a></p>` + "\n"},
+		{"nested list", "- x\n  - y\n- z", "<ul>\n<li>x\n<ul>\n<li>y</li>\n</ul>\n</li>\n<li>z</li>\n</ul>\n"},
+		{"ordered list", "1. a\n2. b", "<ol>\n<li>a</li>\n<li>b</li>\n</ol>\n"},
+		{"table", "| a | b\\|c |\n| --- | --- |\n| 1 | 2 |", "<table>\n<tr><th>a</th><th>b|c</th></tr>\n<tr><td>1</td><td>2</td></tr>\n</table>\n"},
+		{"quote", "> one\n>\n> > two", "<blockquote>\n<p>one</p>\n<blockquote>\n<p>two</p>\n</blockquote>\n</blockquote>\n"},
+		{"pre", "````\n```\n<x>\n````", "<pre><code>```\n&lt;x&gt;</code></pre>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := markdownHTML(tt.in); got != tt.want {
+				t.Errorf("markdownHTML(%q)\n got: %q\nwant: %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExportPDF(t *testing.T) {
+	chdirTemp(t)
+	writeDeck(t, "p", noteDeck)
+	if _, err := AddNote("p", "s2", strings.Repeat("易错", 200), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ExportPDF("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	if !strings.HasPrefix(got, "%PDF-1.4\n") || !strings.HasSuffix(got, "%%EOF\n") {
+		t.Fatalf("not a PDF: %q", got[:20])
+	}
+	for _, want := range []string{"/STSong-Light", pdfHex("第一章"), strings.Trim(pdfHex("易错易错"), "<>"), pdfHex("- A. 2")} {
+		if !strings.Contains(got, want) {
+			t.Errorf("PDF missing %q", want)
+		}
+	}
+
+	// 交叉引用表中的偏移量要指向对应的对象
+	start := strings.LastIndex(got, "startxref\n")
+	var xref int
+	fmt.Sscanf(got[start+len("startxref\n"):], "%d", &xref)
+	if !strings.HasPrefix(got[xref:], "xref\n") {
+		t.Fatalf("startxref %d does not point to xref", xref)
+	}
+	entries := strings.Split(got[xref:], "\n")[3:]
+	for i := 1; strings.HasSuffix(entries[i-1], " n "); i++ {
+		var offset int
+		fmt.Sscanf(entries[i-1], "%d", &offset)
+		if !strings.HasPrefix(got[offset:], fmt.Sprintf("%d 0 obj\n", i)) {
+			t.Errorf("xref entry %d points to %q", i, got[offset:offset+10])
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		in    string
+		width float64
+		want  []string
+	}{
+		{"中文中文 hello world", 6, []string{"中文中文", "hello world"}},
+		{"hello world again", 3, []string{"hello", "world", "again"}},
+		{"abcdefgh", 2, []string{"abcd", "efgh"}},
+		{"", 2, []string{""}},
+	}
+	for _, tt := range tests {
+		if got := wrapText(tt.in, tt.width); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("wrapText(%q, %v) = %q, want %q", tt.in, tt.width, got, tt.want)
+		}
+	}
+}
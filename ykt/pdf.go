@@ -0,0 +1,205 @@
+package ykt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+)
+
+// 把导出的 Markdown 排版成 PDF。为了不引入依赖，这里只输出文字：
+// 中文使用 PDF 阅读器自带的 STSong-Light 字体（不嵌入字体文件），
+// 图片显示为“[图片]”，公式保留 LaTeX 写法，标题、引用、列表的处理与 markdownHTML 一致。
+
+const (
+	pdfPageWidth  = 595.28 // A4
+	pdfPageHeight = 841.89
+	pdfMargin     = 56.0
+	pdfFontSize   = 11.0
+)
+
+type pdfLine struct {
+	size   float64
+	indent float64
+	text   string
+}
+
+// markdownPDF 把 Markdown 排版成 PDF 文件
+func markdownPDF(title, markdown string) []byte {
+	var pages [][]pdfLine
+	var page []pdfLine
+	y := pdfPageHeight - pdfMargin
+	add := func(line pdfLine) {
+		height := line.size * 1.5
+		if y-height < pdfMargin {
+			pages = append(pages, page)
+			page = nil
+			y = pdfPageHeight - pdfMargin
+		}
+		y -= height
+		page = append(page, line)
+	}
+	for _, line := range pdfLines(markdown) {
+		for _, text := range wrapText(line.text, (pdfPageWidth-2*pdfMargin-line.indent)/line.size) {
+			add(pdfLine{size: line.size, indent: line.indent, text: text})
+		}
+	}
+	pages = append(pages, page)
+	return writePDF(title, pages)
+}
+
+// pdfLines 把 Markdown 逐行转成纯文本，标题用大号字，引用和列表缩进
+func pdfLines(markdown string) []pdfLine {
+	var lines []pdfLine
+	inFence := ""
+	for _, line := range strings.Split(markdown, "\n") {
+		if inFence != "" {
+			if isClosingFence(line, inFence) {
+				inFence = ""
+				continue
+			}
+			lines = append(lines, pdfLine{size: pdfFontSize - 1, indent: pdfFontSize, text: line})
+			continue
+		}
+		if strings.HasPrefix(line, "```") {
+			inFence = line[:len(line)-len(strings.TrimLeft(line, "`"))]
+			continue
+		}
+		if tableSepPattern.MatchString(line) {
+			continue
+		}
+
+		size, indent := pdfFontSize, 0.0
+		for strings.HasPrefix(line, ">") {
+			line = strings.TrimPrefix(strings.TrimPrefix(line, ">"), " ")
+			indent += pdfFontSize * 2
+		}
+		if m := headingPattern.FindStringSubmatch(line); m != nil {
+			size = []float64{20, 16, 14, 12, 12, 12}[len(m[1])-1]
+			line = m[2]
+		}
+		if strings.HasPrefix(line, "|") {
+			line = strings.Join(splitCells(line), "  ")
+		}
+		trimmed := strings.TrimLeft(line, " ")
+		indent += float64(len(line)-len(trimmed)) * pdfFontSize / 2
+		lines = append(lines, pdfLine{size: size, indent: indent, text: RenderText(inlineHTML(trimmed))})
+	}
+	return lines
+}
+
+// wrapText 按宽度（以字号为单位）折行，中文字符占 1 个字宽，ASCII 占半个
+func wrapText(text string, width float64) []string {
+	if text == "" {
+		return []string{""}
+	}
+	var lines []string
+	var cur []rune
+	used := 0.0
+	for _, c := range text {
+		w := 1.0
+		if c < 0x80 {
+			w = 0.5
+		}
+		if used+w > width && len(cur) > 0 {
+			// 英文单词尽量不从中间断开
+			cut := len(cur)
+			if c != ' ' && c < 0x80 {
+				for i := len(cur) - 1; i > 0; i-- {
+					if cur[i] == ' ' {
+						cut = i + 1
+						break
+					}
+					if cur[i] >= 0x80 {
+						break
+					}
+				}
+			}
+			lines = append(lines, strings.TrimRight(string(cur[:cut]), " "))
+			cur = append([]rune{}, cur[cut:]...)
+			used = 0
+			for _, r := range cur {
+				if r < 0x80 {
+					used += 0.5
+				} else {
+					used++
+				}
+			}
+			if c == ' ' && len(cur) == 0 {
+				continue
+			}
+		}
+		cur = append(cur, c)
+		used += w
+	}
+	return append(lines, string(cur))
+}
+
+// pdfHex 把文字编码成 UCS-2 十六进制串，超出基本平面的字符用问号代替
+func pdfHex(text string) string {
+	var b strings.Builder
+	b.WriteString("<")
+	for _, c := range text {
+		if c > 0xFFFF {
+			c = '?'
+		}
+		fmt.Fprintf(&b, "%04X", c)
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+// writePDF 输出 PDF 文件结构：目录、页树、字体、各页内容、文档信息和交叉引用表
+func writePDF(title string, pages [][]pdfLine) []byte {
+	var objects []string
+	// 1 目录 2 页树 3-5 字体，之后每页占两个对象（页面和内容流），最后是文档信息
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type0 /BaseFont /STSong-Light /Encoding /UniGB-UCS2-H /DescendantFonts [4 0 R] >>",
+		"<< /Type /Font /Subtype /CIDFontType0 /BaseFont /STSong-Light /CIDSystemInfo << /Registry (Adobe) /Ordering (GB1) /Supplement 2 >> /FontDescriptor 5 0 R /DW 1000 /W [1 95 500] >>",
+		"<< /Type /FontDescriptor /FontName /STSong-Light /Flags 6 /FontBBox [-25 -254 1000 880] /ItalicAngle 0 /Ascent 880 /Descent -120 /CapHeight 880 /StemV 93 >>",
+	)
+	for i, page := range pages {
+		var content strings.Builder
+		y := pdfPageHeight - pdfMargin
+		for _, line := range page {
+			y -= line.size * 1.5
+			if line.text == "" {
+				continue
+			}
+			fmt.Fprintf(&content, "BT /F1 %.1f Tf %.2f %.2f Td %s Tj ET\n", line.size, pdfMargin+line.indent, y, pdfHex(line.text))
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 7+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+		)
+	}
+	// 文档标题用带 BOM 的 UTF-16BE
+	var titleHex strings.Builder
+	titleHex.WriteString("<FEFF")
+	for _, u := range utf16.Encode([]rune(title)) {
+		fmt.Fprintf(&titleHex, "%04X", u)
+	}
+	titleHex.WriteString(">")
+	objects = append(objects, fmt.Sprintf("<< /Title %s /Producer (Fuck-YuKeTang) >>", titleHex.String()))
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n%\xE2\xE3\xCF\xD3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, len(objects), xref)
+	return buf.Bytes()
+}
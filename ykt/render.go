@@ -0,0 +1,599 @@
+package ykt
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 题目 body 和选项 value 中混有 HTML 片段和 LaTeX 公式，这里把它们统一转换成
+// Markdown 或纯文本，公式保持 LaTeX 原样（行内用 $...$，独立公式用 $$...$$）。
+// 题库、导出和查看器都走这一层，保证同一道题在各处显示一致。
+
+var (
+	// 已经是 LaTeX 写法的公式：$$...$$、\[...\]、$...$、\(...\)
+	// 公式中不能出现 HTML 标签，避免跨标签匹配；行内 $...$ 的内容首尾不能是空白，
+	// 避免把“$5 和 $10”这样的金额当成公式
+	mathPattern = regexp.MustCompile(`\$\$((?:[^<$]|<[^a-zA-Z/!$])+?)\$\$|\\\[((?:[^<]|<[^a-zA-Z/!])+?)\\\]|\$([^$\s<](?:(?:[^$\n<]|<[^a-zA-Z/!$\n])*[^$\s<])?)\$|\\\(((?:[^<]|<[^a-zA-Z/!])+?)\\\)`)
+	// HTML 注释和标签
+	tagPattern  = regexp.MustCompile(`(?s)<!--.*?-->|<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:[^>"']|"[^"]*"|'[^']*')*)>`)
+	attrPattern = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	// 占位符，用来在解析 HTML 时保护公式不被当成标签或被折叠空白
+	placeholderPattern = regexp.MustCompile("\x00([0-9]+)\x00")
+	spacePattern       = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blankLinesPattern  = regexp.MustCompile(`\n{3,}`)
+	// 文本中需要转义的 Markdown 字符
+	markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", "&lt;", ">", "&gt;")
+	// 链接地址中会破坏 Markdown 语法的字符
+	urlEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29", "<", "%3C", ">", "%3E", "\n", "", "\r", "")
+	// 行首会被当成标题、列表等块级语法的文本
+	orderedMarkerPattern = regexp.MustCompile(`^([0-9]+)([.)])(\s|$)`)
+	backtickRunPattern   = regexp.MustCompile("`+")
+)
+
+// 引用块在输出中用这两个控制字符标记开始和结束，finish 时换成每行的 "> " 前缀
+const (
+	quoteOpen  = "\x01"
+	quoteClose = "\x02"
+)
+
+// 不输出内容的标签
+var skipTags = map[string]bool{"script": true, "style": true, "head": true, "title": true}
+
+// 块级标签，前后需要换行
+var blockTags = map[string]bool{
+	"p": true, "div": true, "section": true, "article": true, "blockquote": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "table": true, "pre": true, "hr": true,
+}
+
+// 没有结束标签的元素
+var voidTags = map[string]bool{
+	"br": true, "img": true, "hr": true, "input": true, "meta": true, "link": true,
+	"col": true, "area": true, "base": true, "embed": true, "source": true, "wbr": true,
+}
+
+// RenderMarkdown 函数功能：把题目/选项中的 HTML 和公式转换成 Markdown，参数：s（string），返回值：Markdown 文本
+func RenderMarkdown(s string) string {
+	return render(s, true)
+}
+
+// RenderText 函数功能：把题目/选项中的 HTML 和公式转换成纯文本（公式保留 LaTeX），参数：s（string），返回值：纯文本
+func RenderText(s string) string {
+	return render(s, false)
+}
+
+// renderer 保存一次转换过程中的状态
+type renderer struct {
+	markdown bool
+	out      strings.Builder
+	formulas []formulaText
+	lists    []listState // 当前嵌套的列表
+	skip     string      // 正在跳过内容的标签名（script、公式元素等）
+	skipNest int
+	inPre    bool
+	inCode   bool
+	inCell   bool
+	start    int    // 当前 <code>/<pre> 内容在输出中的起始位置
+	link     string // 当前 <a> 的 href
+	rows     int    // 当前表格已输出的行数
+	cells    int    // 当前行的单元格数
+}
+
+// formulaText 一个公式的原文和统一后的写法
+type formulaText struct {
+	raw   string
+	latex string
+}
+
+type listState struct {
+	ordered bool
+	index   int
+}
+
+func render(s string, markdown bool) string {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	r := &renderer{markdown: markdown}
+	// 占位符和引用标记用到的控制字符不能出现在原文中
+	s = strings.Map(func(c rune) rune {
+		if c == 0 || c == 1 || c == 2 {
+			return -1
+		}
+		return c
+	}, s)
+	s = r.protectMath(s)
+
+	last := 0
+	for _, m := range tagPattern.FindAllStringSubmatchIndex(s, -1) {
+		r.text(s[last:m[0]])
+		last = m[1]
+		if m[4] < 0 { // 注释
+			continue
+		}
+		closing := m[3] > m[2]
+		name := strings.ToLower(s[m[4]:m[5]])
+		attrs := r.parseAttrs(s[m[6]:m[7]])
+		if closing {
+			r.closeTag(name)
+		} else {
+			r.openTag(name, attrs, strings.HasSuffix(strings.TrimSpace(s[m[6]:m[7]]), "/"))
+		}
+	}
+	r.text(s[last:])
+
+	return r.finish()
+}
+
+// protectMath 把已有的 LaTeX 公式替换成占位符，统一成 $...$ / $$...$$ 写法
+func (r *renderer) protectMath(s string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range mathPattern.FindAllStringSubmatchIndex(s, -1) {
+		// 闭合的 $ 后面紧跟数字时多半是金额，不当作公式
+		if m[6] >= 0 && m[1] < len(s) && s[m[1]] >= '0' && s[m[1]] <= '9' {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		raw := s[m[0]:m[1]]
+		switch {
+		case m[2] >= 0:
+			b.WriteString(r.formula(raw, s[m[2]:m[3]], true))
+		case m[4] >= 0:
+			b.WriteString(r.formula(raw, s[m[4]:m[5]], true))
+		case m[6] >= 0:
+			b.WriteString(r.formula(raw, s[m[6]:m[7]], false))
+		default:
+			b.WriteString(r.formula(raw, s[m[8]:m[9]], false))
+		}
+		last = m[1]
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+// formula 登记一个公式并返回它的占位符，raw 为公式在原文中的写法
+func (r *renderer) formula(raw, latex string, display bool) string {
+	latex = strings.TrimSpace(html.UnescapeString(latex))
+	if latex == "" {
+		return ""
+	}
+	if display {
+		latex = "$$" + latex + "$$"
+	} else {
+		latex = "$" + latex + "$"
+	}
+	r.formulas = append(r.formulas, formulaText{raw: raw, latex: latex})
+	return fmt.Sprintf("\x00%d\x00", len(r.formulas)-1)
+}
+
+// expand 把占位符替换回公式，latex 为 false 时还原成原文
+func (r *renderer) expand(s string, latex bool) string {
+	// 占位符只来自 protectMath，不会嵌套，这里仍然替换到没有为止
+	for i := 0; i <= len(r.formulas) && strings.Contains(s, "\x00"); i++ {
+		s = placeholderPattern.ReplaceAllStringFunc(s, func(match string) string {
+			n, err := strconv.Atoi(strings.Trim(match, "\x00"))
+			if err != nil || n < 0 || n >= len(r.formulas) {
+				return ""
+			}
+			if latex {
+				return r.formulas[n].latex
+			}
+			return r.formulas[n].raw
+		})
+	}
+	return s
+}
+
+// parseAttrs 解析标签属性，属性值中的公式保持原文
+func (r *renderer) parseAttrs(s string) map[string]string {
+	attrs := map[string]string{}
+	for _, m := range attrPattern.FindAllStringSubmatch(s, -1) {
+		value := r.expand(m[2]+m[3]+m[4], false)
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(value)
+	}
+	return attrs
+}
+
+// formulaAttr 取出公式元素（如 ql-formula、MathJax 图片）中保存的 LaTeX
+func formulaAttr(attrs map[string]string) (string, bool) {
+	for _, key := range []string{"data-latex", "data-formula"} {
+		if latex, ok := attrs[key]; ok {
+			return unwrapMath(latex), true
+		}
+	}
+	if strings.Contains(attrs["class"], "formula") {
+		for _, key := range []string{"data-value", "alt"} {
+			if latex, ok := attrs[key]; ok {
+				return unwrapMath(latex), true
+			}
+		}
+	}
+	return "", false
+}
+
+// unwrapMath 去掉属性值中公式自带的 $、\(、\[ 定界符
+func unwrapMath(latex string) string {
+	latex = strings.TrimSpace(latex)
+	for _, pair := range [][2]string{{"$$", "$$"}, {`\[`, `\]`}, {`\(`, `\)`}, {"$", "$"}} {
+		if len(latex) > len(pair[0])+len(pair[1]) && strings.HasPrefix(latex, pair[0]) && strings.HasSuffix(latex, pair[1]) {
+			return latex[len(pair[0]) : len(latex)-len(pair[1])]
+		}
+	}
+	return latex
+}
+
+func (r *renderer) openTag(name string, attrs map[string]string, selfClosing bool) {
+	if r.skip != "" {
+		if name == r.skip && !voidTags[name] && !selfClosing {
+			r.skipNest++
+		}
+		return
+	}
+	if latex, ok := formulaAttr(attrs); ok {
+		r.write(r.formula(latex, latex, false))
+		if !voidTags[name] && !selfClosing {
+			r.skip, r.skipNest = name, 1
+		}
+		return
+	}
+	if skipTags[name] {
+		if !selfClosing {
+			r.skip, r.skipNest = name, 1
+		}
+		return
+	}
+	if blockTags[name] {
+		r.blockOrLine(name)
+	}
+
+	switch name {
+	case "br":
+		r.newline()
+	case "hr":
+		if r.markdown {
+			r.write("---")
+		}
+		r.block()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		if r.markdown {
+			level, _ := strconv.Atoi(name[1:])
+			r.write(strings.Repeat("#", level) + " ")
+		}
+	case "b", "strong":
+		r.mark("**")
+	case "i", "em":
+		r.mark("*")
+	case "s", "del", "strike":
+		r.mark("~~")
+	case "code":
+		if !r.inPre && !r.inCode {
+			r.inCode = true
+			r.start = r.out.Len()
+		}
+	case "pre":
+		if !r.inPre {
+			r.inPre = true
+			r.start = r.out.Len()
+		}
+	case "sub":
+		// Markdown 没有上下标语法，保留 HTML 标签
+		if r.markdown {
+			r.write("<sub>")
+		} else {
+			r.write("_")
+		}
+	case "sup":
+		if r.markdown {
+			r.write("<sup>")
+		} else {
+			r.write("^")
+		}
+	case "blockquote":
+		r.mark(quoteOpen)
+	case "ul", "ol":
+		r.lists = append(r.lists, listState{ordered: name == "ol"})
+	case "li":
+		r.newline()
+		depth := len(r.lists)
+		bullet := "- "
+		if depth > 0 {
+			top := &r.lists[depth-1]
+			top.index++
+			if top.ordered {
+				bullet = strconv.Itoa(top.index) + ". "
+			}
+			r.write(strings.Repeat("  ", depth-1))
+		}
+		r.write(bullet)
+	case "table":
+		r.rows = 0
+	case "tr":
+		r.newline()
+		r.cells = 0
+	case "td", "th":
+		r.cells++
+		r.inCell = true
+		r.write(" | ")
+	case "a":
+		r.link = attrs["href"]
+		if r.markdown && r.link != "" {
+			r.write("[")
+		}
+	case "img":
+		r.image(attrs)
+	}
+}
+
+func (r *renderer) closeTag(name string) {
+	if r.skip != "" {
+		if name == r.skip {
+			r.skipNest--
+			if r.skipNest == 0 {
+				r.skip = ""
+			}
+		}
+		return
+	}
+
+	switch name {
+	case "b", "strong":
+		r.mark("**")
+	case "i", "em":
+		r.mark("*")
+	case "s", "del", "strike":
+		r.mark("~~")
+	case "code":
+		if r.inCode {
+			r.inCode = false
+			r.fence(false)
+		}
+	case "pre":
+		if r.inPre {
+			r.inPre = false
+			r.fence(true)
+		}
+	case "blockquote":
+		r.mark(quoteClose)
+	case "td", "th":
+		r.inCell = false
+	case "sub", "sup":
+		r.mark("</" + name + ">")
+	case "ul", "ol":
+		if len(r.lists) > 0 {
+			r.lists = r.lists[:len(r.lists)-1]
+		}
+	case "li":
+		r.newline()
+	case "tr":
+		r.rows++
+		// Markdown 表格的第一行是表头，后面要跟一行分隔线
+		if r.markdown && r.rows == 1 && r.cells > 0 {
+			r.write("\n" + strings.Repeat(" | ---", r.cells))
+		}
+		r.newline()
+	case "a":
+		if r.markdown && r.link != "" {
+			r.write("](" + urlEscaper.Replace(r.link) + ")")
+		}
+		r.link = ""
+	}
+	if blockTags[name] {
+		r.blockOrLine(name)
+	}
+}
+
+// image 输出图片，Markdown 中保留链接，纯文本中只留一个提示
+func (r *renderer) image(attrs map[string]string) {
+	src := attrs["src"]
+	if src == "" {
+		return
+	}
+	if r.markdown {
+		r.write(fmt.Sprintf("![%s](%s)", markdownEscaper.Replace(attrs["alt"]), urlEscaper.Replace(src)))
+	} else {
+		r.write("[图片]")
+	}
+}
+
+// mark 输出 Markdown 的强调符号，纯文本时忽略
+func (r *renderer) mark(s string) {
+	if r.markdown {
+		r.write(s)
+	}
+}
+
+// text 输出标签之间的文本，折叠空白并还原 HTML 实体
+func (r *renderer) text(s string) {
+	if r.skip != "" || s == "" {
+		return
+	}
+	s = html.UnescapeString(s)
+	s = strings.ReplaceAll(s, " ", " ")
+	if !r.inPre {
+		s = spacePattern.ReplaceAllString(s, " ")
+		// 行首或已有空格时不再重复输出空格
+		if r.afterSpace() {
+			s = strings.TrimLeft(s, " ")
+		}
+	}
+	// 代码中的内容原样输出，其余文本转义 Markdown 字符
+	if r.markdown && !r.inPre && !r.inCode {
+		s = markdownEscaper.Replace(s)
+		if r.atLineStart() {
+			s = escapeLineStart(s)
+		}
+	}
+	if r.markdown && r.inCell {
+		s = strings.ReplaceAll(s, "|", `\|`)
+	}
+	r.write(s)
+}
+
+// escapeLineStart 转义行首会被当成标题、列表、分隔线的字符
+func escapeLineStart(s string) string {
+	if s == "" {
+		return s
+	}
+	switch s[0] {
+	case '#', '-', '+', '=':
+		return `\` + s
+	}
+	return orderedMarkerPattern.ReplaceAllString(s, `$1\$2$3`)
+}
+
+// fence 给 <code>/<pre> 的内容加上比其中最长的反引号还长的围栏
+func (r *renderer) fence(block bool) {
+	if !r.markdown {
+		return
+	}
+	out := r.out.String()
+	if r.start > len(out) {
+		r.start = len(out)
+	}
+	content := out[r.start:]
+	longest := 0
+	for _, run := range backtickRunPattern.FindAllString(content, -1) {
+		if len(run) > longest {
+			longest = len(run)
+		}
+	}
+	var wrapped string
+	if block {
+		fence := strings.Repeat("`", max(3, longest+1))
+		wrapped = fence + "\n" + strings.Trim(content, "\n") + "\n" + fence
+	} else {
+		if content == "" {
+			return
+		}
+		fence := strings.Repeat("`", longest+1)
+		// 内容以反引号开头或结尾时要用空格隔开
+		if strings.HasPrefix(content, "`") || strings.HasSuffix(content, "`") {
+			content = " " + content + " "
+		}
+		wrapped = fence + content + fence
+	}
+	r.out.Reset()
+	r.out.WriteString(out[:r.start] + wrapped)
+}
+
+func (r *renderer) write(s string) {
+	r.out.WriteString(s)
+}
+
+// tail 返回去掉末尾引用标记的输出，用来判断当前是否在行首
+func (r *renderer) tail() string {
+	return strings.TrimRight(r.out.String(), quoteOpen+quoteClose)
+}
+
+func (r *renderer) atLineStart() bool {
+	cur := r.tail()
+	return cur == "" || strings.HasSuffix(cur, "\n")
+}
+
+func (r *renderer) afterSpace() bool {
+	return r.atLineStart() || strings.HasSuffix(r.tail(), " ")
+}
+
+// newline 换行（已在行首时不重复换行）
+func (r *renderer) newline() {
+	cur := r.tail()
+	if cur != "" && !strings.HasSuffix(cur, "\n") {
+		r.write("\n")
+	}
+}
+
+// blockOrLine 块级标签前后分段，嵌套在列表中的列表只换行
+func (r *renderer) blockOrLine(name string) {
+	if (name == "ul" || name == "ol") && len(r.lists) > 0 {
+		r.newline()
+		return
+	}
+	r.block()
+}
+
+// block 开始一个新段落
+func (r *renderer) block() {
+	cur := r.tail()
+	if cur == "" || strings.HasSuffix(cur, "\n\n") {
+		return
+	}
+	if strings.HasSuffix(cur, "\n") {
+		r.write("\n")
+	} else {
+		r.write("\n\n")
+	}
+}
+
+// quoteLines 把引用标记换成每行的 "> " 前缀。空行夹在同一层引用中间时
+// 也要加 ">"，否则引用会在空行处断开
+func quoteLines(lines []string) []string {
+	depths := make([]int, len(lines)) // 每行内容所在的引用层数，空行为 -1
+	depth := 0
+	for i, line := range lines {
+		depths[i] = -1
+		for _, c := range line {
+			switch string(c) {
+			case quoteOpen:
+				depth++
+			case quoteClose:
+				if depth > 0 {
+					depth--
+				}
+			default:
+				if depths[i] < 0 {
+					depths[i] = depth
+				}
+			}
+		}
+		lines[i] = strings.NewReplacer(quoteOpen, "", quoteClose, "").Replace(line)
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = ""
+			depths[i] = -1
+		}
+	}
+
+	prev := 0
+	for i, line := range lines {
+		d := depths[i]
+		if d < 0 {
+			// 空行取前后两行内容中较浅的一层
+			next := 0
+			for j := i + 1; j < len(lines); j++ {
+				if depths[j] >= 0 {
+					next = depths[j]
+					break
+				}
+			}
+			d = min(prev, next)
+			if d > 0 {
+				lines[i] = strings.TrimSpace(strings.Repeat("> ", d))
+			}
+			continue
+		}
+		prev = d
+		if d > 0 {
+			lines[i] = strings.Repeat("> ", d) + line
+		}
+	}
+	return lines
+}
+
+// finish 还原公式占位符并整理空行
+func (r *renderer) finish() string {
+	s := r.expand(r.out.String(), true)
+
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+		if strings.HasPrefix(lines[i], " | ") {
+			lines[i] = strings.TrimPrefix(lines[i], " ") + " |"
+		}
+	}
+	s = strings.Join(quoteLines(lines), "\n")
+	s = blankLinesPattern.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,87 @@
+package ykt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"empty", "  ", ""},
+		{"whitespace", "  plain \n  text  ", "plain text"},
+		{"paragraphs", "<p>第一段</p><p>第二段<br>换行</p>", "第一段\n\n第二段\n换行"},
+		{"entities", "A &amp; B&nbsp;C", "A & B C"},
+		{"emphasis", "<b>粗</b><em>斜</em><s>删</s>", "**粗***斜*~~删~~"},
+		{"inline math", `设 $a &lt; b$、$c < d$ 且 \(x^2\)`, "设 $a < b$、$c < d$ 且 $x^2$"},
+		{"math across tags", "<p>$</p><p>$</p>", "$\n\n$"},
+		{"display math across tags", "<p>$$a</p><p>b$$</p>", "$$a\n\nb$$"},
+		{"display math", `<p>则 \[\sum_i x_i\]</p><p>$$ y $$</p>`, "则 $$\\sum_i x_i$$\n\n$$y$$"},
+		{"dollar amounts", "<p>价格 $5 和 $10</p>", `价格 $5 和 $10`},
+		{"dollar before digit", "$x$2", "$x$2"},
+		{"formula span", `<span class="ql-formula" data-value="\frac{a}{b}&lt;1">忽略</span>`, `$\frac{a}{b}<1$`},
+		{"formula image alt", `<img class="formula" alt="$x^2$" src="a.png">`, "$x^2$"},
+		{"formula data-latex", `<img data-latex="\(y\)" src="a.png">`, "$y$"},
+		{"image", `<img src="http://a/b.png" alt="图[1]">`, `![图\[1\]](http://a/b.png)`},
+		{"escape html", "&lt;script&gt;alert(1)&lt;/script&gt;", "&lt;script&gt;alert(1)&lt;/script&gt;"},
+		{"escape markdown", "a*b_c `d` [e]", "a\\*b\\_c \\`d\\` \\[e\\]"},
+		{"script dropped", "前<script>alert(1)</script>后", "前后"},
+		{"sub sup", "H<sub>2</sub>O x<sup>2</sup>", "H<sub>2</sub>O x<sup>2</sup>"},
+		{"ordered list", "<ol><li>甲</li><li>乙 <em>丙</em></li></ol>", "1. 甲\n2. 乙 *丙*"},
+		{"nested list", "<ul><li>x<ul><li>y</li></ul></li></ul>", "- x\n  - y"},
+		{"table", "<table><tr><td>a</td><td>b</td></tr><tr><td>c</td><td>d</td></tr></table>", "| a | b |\n| --- | --- |\n| c | d |"},
+		{"inline code", "<code>a*b</code>", "`a*b`"},
+		{"pre", "<pre>if a < b {\n    x_1\n}</pre>", "```\nif a < b {\n    x_1\n}\n```"},
+		{"link", `<a href="http://x">链接</a>`, "[链接](http://x)"},
+		{"heading", "<h2>标题</h2>正文", "## 标题\n\n正文"},
+		{"blockquote", "<blockquote><p>one</p><p>two</p></blockquote><p>after</p>", "> one\n>\n> two\n\nafter"},
+		{"nested blockquote", "<blockquote>a<blockquote>b</blockquote>c</blockquote>", "> a\n>\n> > b\n>\n> c"},
+		{"placeholder in input", "a\x005\x00b\x01c\x02", "a5bc"},
+		{"pipe in cell", "<table><tr><td>a|b</td></tr></table>", "| a\\|b |\n| --- |"},
+		{"link url", `<a href="http://x/a b(1)">链接</a>`, "[链接](http://x/a%20b%281%29)"},
+		{"image url", `<img src="http://x/a b).png">`, "![](http://x/a%20b%29.png)"},
+		{"backtick in code", "<code>a`b</code>", "``a`b``"},
+		{"backtick at code edge", "<code>`a</code>", "`` `a ``"},
+		{"backticks in pre", "<pre>```\nx\n```</pre>", "````\n```\nx\n```\n````"},
+		{"leading heading marker", "<p># 不是标题</p><p>- 不是列表</p>", "\\# 不是标题\n\n\\- 不是列表"},
+		{"leading ordered marker", "第一行<br>1. 不是列表", "第一行\n1\\. 不是列表"},
+		{"marker mid line", "a # b 1. c", "a # b 1. c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := RenderMarkdown(tt.in)
+			if got != tt.want {
+				t.Errorf("RenderMarkdown(%q)\n got: %q\nwant: %q", tt.in, got, tt.want)
+			}
+			if strings.Contains(got, "\x00") {
+				t.Errorf("RenderMarkdown(%q) left a placeholder: %q", tt.in, got)
+			}
+		})
+	}
+}
+
+func TestRenderText(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"emphasis", "<b>粗</b> *星号*", "粗 *星号*"},
+		{"formula span", `已知 <span class="ql-formula" data-value="x^2">x</span>`, "已知 $x^2$"},
+		{"image", `<img src="http://a/b.png">`, "[图片]"},
+		{"sub sup", "H<sub>2</sub>O x<sup>2</sup>", "H_2O x^2"},
+		{"link", `<a href="http://x">链接</a>`, "链接"},
+		{"list", "<ul><li>a</li><li>b</li></ul>", "- a\n- b"},
+		{"dollar amounts", "价格 $5 和 $10", "价格 $5 和 $10"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RenderText(tt.in); got != tt.want {
+				t.Errorf("RenderText(%q)\n got: %q\nwant: %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
@@ -197,58 +197,16 @@ func GetLessonOtherInfo(sessionid string, lessonId string) (string, string, stri
 // UpdateBanks 函数功能：更新题库，参数：presentationID（string），返回值：无
 func UpdateBanks(presentationID string) {
 	// 读取 JSON 文件
-	filePath := fmt.Sprintf("./ppts/%s.json", presentationID)
-	fileData, err := os.ReadFile(filePath)
+	fileData, err := os.ReadFile(deckPath(presentationID))
 	if err != nil {
 		log.Println("Error reading file:", err)
 		return
 	}
 
-	// 使用 gjson 解析文件
-	slides := gjson.Get(string(fileData), "data.slides")
-
-	var qaList []map[string]interface{}
-
-	slides.ForEach(func(key, value gjson.Result) bool {
-		// 如果 slide 中包含 problem
-		if value.Get("problem").Exists() {
-			problem := value.Get("problem")
-			problemID := problem.Get("problemId").String()
-			problemType := problem.Get("problemType").Int()
-			question := problem.Get("body").String()
-
-			// 获取 answers 或 result 字段
-			answers := problem.Get("answers")
-			if !answers.Exists() {
-				answers = problem.Get("result")
-			}
-
-			// 处理 options
-			options := map[string]string{}
-			problem.Get("options").ForEach(func(_, option gjson.Result) bool {
-				key := option.Get("key").String()
-				value := option.Get("value").String()
-				options[key] = value
-				return true
-			})
-
-			qa := map[string]interface{}{
-				"presentation_id": presentationID,
-				"problemId":       problemID,
-				"problemType":     problemType,
-				"question":        question,
-				"answers":         answers.Value(),
-				"options":         options,
-			}
-
-			qaList = append(qaList, qa)
-		}
-		return true
-	})
+	qaList := deckProblems(presentationID, fileData)
 
 	// 读取已有的 bank.json 文件
 	var existingQAList []map[string]interface{}
-	bankFilePath := "./bank.json"
 	bankFileData, err := os.ReadFile(bankFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -280,7 +238,7 @@ func UpdateBanks(presentationID string) {
 		return
 	}
 
-	err = os.WriteFile(bankFilePath, updatedData, 0644)
+	err = writeFileAtomic(bankFilePath, updatedData, 0644)
 	if err != nil {
 		log.Println("Error writing to bank.json:", err)
 		return
@@ -289,6 +247,53 @@ func UpdateBanks(presentationID string) {
 	log.Println("--------------------------题库更新成功---------------------")
 }
 
+// deckProblems 从 PPT 中提取题目，生成题库条目
+func deckProblems(presentationID string, fileData []byte) []map[string]interface{} {
+	// 使用 gjson 解析文件
+	slides := gjson.GetBytes(fileData, "data.slides")
+
+	var qaList []map[string]interface{}
+
+	slides.ForEach(func(key, value gjson.Result) bool {
+		// 如果 slide 中包含 problem
+		if value.Get("problem").Exists() {
+			problem := value.Get("problem")
+			problemID := problem.Get("problemId").String()
+			problemType := problem.Get("problemType").Int()
+			// 题干和选项中的 HTML、公式统一转换成 Markdown 再存入题库
+			question := RenderMarkdown(problem.Get("body").String())
+
+			// 获取 answers 或 result 字段
+			answers := problem.Get("answers")
+			if !answers.Exists() {
+				answers = problem.Get("result")
+			}
+
+			// 处理 options
+			options := map[string]string{}
+			problem.Get("options").ForEach(func(_, option gjson.Result) bool {
+				key := option.Get("key").String()
+				value := RenderMarkdown(option.Get("value").String())
+				options[key] = value
+				return true
+			})
+
+			qa := map[string]interface{}{
+				"presentation_id": presentationID,
+				"problemId":       problemID,
+				"problemType":     problemType,
+				"question":        question,
+				"answers":         answers.Value(),
+				"options":         options,
+			}
+
+			qaList = append(qaList, qa)
+		}
+		return true
+	})
+	return qaList
+}
+
 // 异步获取PPT
 func StorePPT(sessionid, presentationID, auth string) error {
 	// Create the request
@@ -326,15 +331,28 @@ func StorePPT(sessionid, presentationID, auth string) error {
 	}
 	// log.Printf("响应体长度: %d", len(body))
 
+	// 内容不完整时不覆盖已保存的 PPT
+	if err := checkDeck(body); err != nil {
+		return fmt.Errorf("PPT %s 内容异常: %v", presentationID, err)
+	}
+	// 幻灯片有变化时先保留旧版本
+	if err := snapshotDeck(presentationID, body); err != nil {
+		log.Println("Error saving snapshot:", err)
+	}
+
 	// Save the response to a file
-	fileName := fmt.Sprintf("./ppts/%s.json", presentationID)
-	err = os.WriteFile(fileName, body, 0644)
+	fileName := deckPath(presentationID)
+	err = writeFileAtomic(fileName, body, 0644)
 	if err != nil {
 		return err
 	}
 
 	log.Printf("-----------PPT文件保存在: %s------------\n", fileName)
-	UpdateBanks(presentationID) // 更新题库
+	UpdateBanks(presentationID)   // 更新题库
+	ReattachNotes(presentationID) // 把个人批注挂回幻灯片
+	if AssetCaching {
+		go CacheAssets(presentationID) // 缓存幻灯片图片
+	}
 	return nil
 }
 